@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/auth"
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/handlers"
+)
+
+// authConfig enables authentication of the API when API keys or JWT validation are configured. The probes and
+// /metrics stay unauthenticated.
+type authConfig struct {
+	// APIKeysFile is a secret file with one "<principal>:<key>" pair per line.
+	APIKeysFile string         `yaml:"apiKeysFile,omitempty"`
+	JWT         auth.JWTConfig `yaml:"jwt,omitempty"`
+	// Policies restrict the streams and records each principal may read. Without policies, every authenticated
+	// principal may read everything.
+	Policies handlers.Policies `yaml:"policies,omitempty"`
+}
+
+func (c authConfig) enabled() bool {
+	return c.APIKeysFile != "" || c.JWT.Enabled()
+}
+
+// files lists the files the authenticator is built from, so that rotated secrets are reloaded.
+func (c authConfig) files() []string {
+	var files []string
+	for _, file := range []string{c.APIKeysFile, c.JWT.JWKSFile} {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+func (c authConfig) validate() error {
+	var errs []error
+	if len(c.Policies) > 0 && !c.enabled() {
+		errs = append(errs, errors.New("policies require apiKeysFile or jwt to authenticate principals"))
+	}
+	if !c.JWT.Enabled() {
+		return errors.Join(errs...)
+	}
+	if c.JWT.Issuer == "" && c.JWT.JWKSFile == "" {
+		errs = append(errs, errors.New("jwt: issuer or jwksFile must be provided"))
+	}
+	if c.JWT.Issuer != "" && c.JWT.JWKSFile == "" {
+		issuer, err := url.Parse(c.JWT.Issuer)
+		if err != nil || (issuer.Scheme != "http" && issuer.Scheme != "https") || issuer.Host == "" {
+			errs = append(errs, fmt.Errorf("jwt: invalid issuer %q: must be an absolute http(s) URL to discover its keys",
+				c.JWT.Issuer))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// newAuthenticator reads the API keys and the JWKS. It returns nil when authentication is disabled.
+func newAuthenticator(cfg authConfig) (auth.Authenticator, error) {
+	if !cfg.enabled() {
+		return nil, nil //nolint:nilnil // no authenticator means anonymous access
+	}
+	var chain auth.Chain
+	if cfg.APIKeysFile != "" {
+		keys, err := auth.LoadAPIKeys(cfg.APIKeysFile)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, keys)
+	}
+	if cfg.JWT.Enabled() {
+		jwt, err := auth.NewJWT(cfg.JWT, http.DefaultClient)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, jwt)
+	}
+	return chain, nil
+}
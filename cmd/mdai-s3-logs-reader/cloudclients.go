@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	gcs "cloud.google.com/go/storage"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"google.golang.org/api/option"
+)
+
+// azureOptions configures access to Azure Blob Storage. Without a connection string or account key, the default
+// Azure credential chain is used, which covers workload identity on AKS.
+type azureOptions struct {
+	AccountName         string `yaml:"accountName,omitempty"`
+	Endpoint            string `yaml:"endpoint,omitempty"`
+	ConnectionStringEnv string `yaml:"connectionStringEnv,omitempty"`
+	AccountKeyEnv       string `yaml:"accountKeyEnv,omitempty"`
+}
+
+// gcsOptions configures access to Google Cloud Storage. Without a credentials file, Application Default Credentials
+// are used, which cover workload identity on GKE. STORAGE_EMULATOR_HOST is honored as well.
+type gcsOptions struct {
+	Endpoint              string `yaml:"endpoint,omitempty"`
+	CredentialsFile       string `yaml:"credentialsFile,omitempty"`
+	WithoutAuthentication *bool  `yaml:"withoutAuthentication,omitempty"`
+}
+
+// merge fills the zero fields of o from defaults. The connection string and account key are inherited together, so
+// that the credentials a stream sets are not mixed with those of the storage section.
+func (o azureOptions) merge(defaults azureOptions) azureOptions {
+	if o.AccountName == "" {
+		o.AccountName = defaults.AccountName
+	}
+	if o.Endpoint == "" {
+		o.Endpoint = defaults.Endpoint
+	}
+	if o.ConnectionStringEnv == "" && o.AccountKeyEnv == "" {
+		o.ConnectionStringEnv = defaults.ConnectionStringEnv
+		o.AccountKeyEnv = defaults.AccountKeyEnv
+	}
+	return o
+}
+
+// merge fills the unset fields of o from defaults. A stream's credentials file replaces the authentication of the
+// storage section, and its withoutAuthentication: true the credentials file.
+func (o gcsOptions) merge(defaults gcsOptions) gcsOptions {
+	if o.Endpoint == "" {
+		o.Endpoint = defaults.Endpoint
+	}
+	if o.WithoutAuthentication == nil && o.CredentialsFile == "" {
+		o.WithoutAuthentication = defaults.WithoutAuthentication
+	}
+	if o.CredentialsFile == "" && !aws.ToBool(o.WithoutAuthentication) {
+		o.CredentialsFile = defaults.CredentialsFile
+	}
+	o.WithoutAuthentication = sharedFlag(o.WithoutAuthentication)
+	return o
+}
+
+func newAzureContainerClient(opts azureOptions, containerName string) (*container.Client, error) {
+	if opts.ConnectionStringEnv != "" {
+		connectionString := os.Getenv(opts.ConnectionStringEnv)
+		if connectionString == "" {
+			return nil, fmt.Errorf("environment variable %s must be set", opts.ConnectionStringEnv)
+		}
+		return container.NewClientFromConnectionString(connectionString, containerName, nil)
+	}
+
+	endpoint := opts.Endpoint
+	if endpoint == "" {
+		if opts.AccountName == "" {
+			return nil, errors.New("accountName, endpoint or connectionStringEnv must be provided for the azure backend")
+		}
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net/", opts.AccountName)
+	}
+	containerURL := strings.TrimSuffix(endpoint, "/") + "/" + containerName
+
+	if opts.AccountKeyEnv != "" {
+		accountKey := os.Getenv(opts.AccountKeyEnv)
+		if opts.AccountName == "" || accountKey == "" {
+			return nil, fmt.Errorf("accountName and environment variable %s must be set", opts.AccountKeyEnv)
+		}
+		cred, err := container.NewSharedKeyCredential(opts.AccountName, accountKey)
+		if err != nil {
+			return nil, err
+		}
+		return container.NewClientWithSharedKeyCredential(containerURL, cred, nil)
+	}
+
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load Azure credentials: %w", err)
+	}
+	return container.NewClient(containerURL, cred, nil)
+}
+
+func newGCSClient(ctx context.Context, opts gcsOptions) (*gcs.Client, error) {
+	var clientOpts []option.ClientOption
+	if opts.Endpoint != "" {
+		clientOpts = append(clientOpts, option.WithEndpoint(opts.Endpoint))
+	}
+	switch {
+	case aws.ToBool(opts.WithoutAuthentication) && opts.CredentialsFile != "":
+		return nil, errors.New("withoutAuthentication and credentialsFile are mutually exclusive")
+	case aws.ToBool(opts.WithoutAuthentication):
+		clientOpts = append(clientOpts, option.WithoutAuthentication())
+	case opts.CredentialsFile != "":
+		// The credentials file is part of the trusted deployment configuration.
+		clientOpts = append(clientOpts, option.WithCredentialsFile(opts.CredentialsFile))
+	}
+
+	client, err := gcs.NewClient(ctx, clientOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create GCS client: %w", err)
+	}
+	return client, nil
+}
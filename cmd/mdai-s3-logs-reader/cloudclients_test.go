@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAzureOptionsMerge(t *testing.T) {
+	defaults := azureOptions{
+		AccountName:         "mdailogs",
+		ConnectionStringEnv: "AZURE_STORAGE_CONNECTION_STRING",
+		AccountKeyEnv:       "AZURE_STORAGE_KEY",
+	}
+
+	assert.Equal(t, azureOptions{
+		AccountName:         "mdailogs",
+		Endpoint:            "https://mdailogs.privatelink.blob.core.windows.net/",
+		ConnectionStringEnv: "AZURE_STORAGE_CONNECTION_STRING",
+		AccountKeyEnv:       "AZURE_STORAGE_KEY",
+	}, azureOptions{Endpoint: "https://mdailogs.privatelink.blob.core.windows.net/"}.merge(defaults))
+
+	assert.Equal(t, azureOptions{
+		AccountName:   "audit",
+		AccountKeyEnv: "AUDIT_STORAGE_KEY",
+	}, azureOptions{AccountName: "audit", AccountKeyEnv: "AUDIT_STORAGE_KEY"}.merge(defaults),
+		"the credentials of a stream are not mixed with those of the storage section")
+}
+
+func TestGCSOptionsMerge(t *testing.T) {
+	anonymous := gcsOptions{Endpoint: "http://fake-gcs:4443/storage/v1/", WithoutAuthentication: aws.Bool(true)}
+
+	inherited := gcsOptions{}.merge(anonymous)
+	assert.Equal(t, anonymous, inherited)
+	assert.True(t, inherited == gcsOptions{}.merge(gcsOptions{
+		Endpoint:              "http://fake-gcs:4443/storage/v1/",
+		WithoutAuthentication: aws.Bool(true),
+	}), "merged options with the same flags must compare equal as map keys")
+
+	merged := gcsOptions{CredentialsFile: "/var/run/secrets/gcs/key.json"}.merge(anonymous)
+	assert.False(t, aws.ToBool(merged.WithoutAuthentication))
+	assert.Equal(t, "/var/run/secrets/gcs/key.json", merged.CredentialsFile)
+	assert.NoError(t, storeOptions{GCS: merged}.validateOptions())
+
+	merged = gcsOptions{WithoutAuthentication: aws.Bool(false)}.merge(anonymous)
+	assert.False(t, aws.ToBool(merged.WithoutAuthentication))
+
+	withFile := gcsOptions{CredentialsFile: "/var/run/secrets/gcs/key.json"}
+	assert.Equal(t, withFile, gcsOptions{}.merge(withFile))
+	merged = gcsOptions{WithoutAuthentication: aws.Bool(true)}.merge(withFile)
+	assert.True(t, aws.ToBool(merged.WithoutAuthentication))
+	assert.Empty(t, merged.CredentialsFile)
+}
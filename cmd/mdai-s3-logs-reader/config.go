@@ -0,0 +1,417 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/handlers"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultListenAddress     = ":4400" // Grafana uses port 3000, so making port 4400
+	defaultReadHeaderTimeout = 5 * time.Second
+	defaultReadTimeout       = 10 * time.Second
+	defaultWriteTimeout      = 10 * time.Second
+	defaultIdleTimeout       = 120 * time.Second
+	defaultReloadInterval    = 10 * time.Second
+	defaultDrainPeriod       = 25 * time.Second
+)
+
+// config is the effective configuration: the defaults, overlaid with the config file, overlaid with the environment.
+type config struct {
+	Server serverConfig `yaml:"server"`
+	// Storage holds the backend options inherited by every stream. When it names a bucket or path, the undeclared streams
+	// matching StreamPatterns are served from it.
+	Storage storeOptions `yaml:"storage"`
+	// StreamPatterns lists the path.Match patterns of the undeclared streams served from Storage, e.g. "hub-*-logs".
+	StreamPatterns []string            `yaml:"streamPatterns,omitempty"`
+	Streams        []streamConfig      `yaml:"streams"`
+	Limits         handlers.Limits     `yaml:"limits"`
+	RateLimits     handlers.RateLimits `yaml:"rateLimits"`
+	HourCache      handlers.HourCache  `yaml:"hourCache"`
+	// Compression and CORS apply on restart only.
+	Compression handlers.Compression `yaml:"compression"`
+	CORS        handlers.CORS        `yaml:"cors"`
+	Tracing     tracingConfig        `yaml:"tracing"`
+	Logging     loggingConfig        `yaml:"logging"`
+	Auth        authConfig           `yaml:"auth"`
+}
+
+type serverConfig struct {
+	Address           string        `yaml:"address"`
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout"`
+	ReadTimeout       time.Duration `yaml:"readTimeout"`
+	// WriteTimeout bounds writing short responses. Handlers that query storage extend it past their own timeout
+	// (limits.queryTimeout for logs), so that long queries are answered instead of dropping the connection.
+	WriteTimeout     time.Duration `yaml:"writeTimeout"`
+	IdleTimeout      time.Duration `yaml:"idleTimeout"`
+	SkipStartupCheck bool          `yaml:"skipStartupCheck"`
+	// ReloadInterval is how often the config file is checked for changes; 0 only reloads on SIGHUP.
+	ReloadInterval time.Duration `yaml:"reloadInterval"`
+	// DrainPeriod is how long in-flight requests may run after SIGTERM before they are canceled. It should stay below
+	// the pod's termination grace period.
+	DrainPeriod time.Duration `yaml:"drainPeriod"`
+	// TLS serves HTTPS instead of HTTP; it applies on restart, except for rotated certificates.
+	TLS tlsConfig `yaml:"tls"`
+}
+
+func defaultConfig() config {
+	return config{
+		Server: serverConfig{
+			Address:           defaultListenAddress,
+			ReadHeaderTimeout: defaultReadHeaderTimeout,
+			ReadTimeout:       defaultReadTimeout,
+			WriteTimeout:      defaultWriteTimeout,
+			IdleTimeout:       defaultIdleTimeout,
+			ReloadInterval:    defaultReloadInterval,
+			DrainPeriod:       defaultDrainPeriod,
+			TLS:               tlsConfig{MinVersion: tlsVersion12},
+		},
+		Limits:      handlers.DefaultLimits(),
+		RateLimits:  handlers.DefaultRateLimits(),
+		HourCache:   handlers.DefaultHourCache(),
+		Compression: handlers.DefaultCompression(),
+		CORS:        handlers.DefaultCORS(),
+		Tracing: tracingConfig{
+			ServiceName: defaultServiceName,
+			SampleRatio: 1,
+		},
+		Logging: loggingConfig{
+			Level:  "info",
+			Format: logFormatText,
+		},
+	}
+}
+
+// loadConfig reads the config file at path, if any, applies the environment overrides and validates the result.
+func loadConfig(path string) (config, error) {
+	cfg := defaultConfig()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return config{}, fmt.Errorf("reading config: %w", err)
+		}
+		if err := decodeConfig(data, &cfg); err != nil {
+			return config{}, fmt.Errorf("parsing config %s: %w", path, err)
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return config{}, err
+	}
+	if err := cfg.validate(); err != nil {
+		return config{}, fmt.Errorf("invalid config: %w", err)
+	}
+	return cfg, nil
+}
+
+// decodeConfig decodes data over cfg, rejecting unknown fields so that typos do not go unnoticed.
+func decodeConfig(data []byte, cfg *config) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// applyEnv overrides the config with the environment variables that are set.
+func (c *config) applyEnv() error {
+	overrideString(&c.Server.Address, "LISTEN_ADDRESS")
+	overrideString(&c.Server.TLS.CertFile, "TLS_CERT_FILE")
+	overrideString(&c.Server.TLS.KeyFile, "TLS_KEY_FILE")
+	overrideString(&c.Server.TLS.ClientCAFile, "TLS_CLIENT_CA_FILE")
+	overrideString(&c.Storage.Backend, "STORAGE_BACKEND")
+	overrideString(&c.Storage.Bucket, "STORAGE_BUCKET", "S3_BUCKET")
+	overrideString(&c.Storage.Path, "STORAGE_PATH")
+	if value := os.Getenv("STREAM_PATTERNS"); value != "" {
+		c.StreamPatterns = strings.FieldsFunc(value, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+	}
+	if value := os.Getenv("CORS_ALLOWED_ORIGINS"); value != "" {
+		c.CORS.AllowedOrigins = strings.FieldsFunc(value, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+	}
+
+	overrideString(&c.Storage.S3.Region, "AWS_REGION")
+	overrideString(&c.Storage.S3.Endpoint, "S3_ENDPOINT_URL")
+	overrideString(&c.Storage.S3.CABundle, "S3_CA_BUNDLE")
+
+	overrideString(&c.Storage.Azure.AccountName, "AZURE_STORAGE_ACCOUNT")
+	overrideString(&c.Storage.Azure.Endpoint, "AZURE_STORAGE_BLOB_ENDPOINT")
+	if os.Getenv("AZURE_STORAGE_CONNECTION_STRING") != "" {
+		c.Storage.Azure.ConnectionStringEnv = "AZURE_STORAGE_CONNECTION_STRING"
+	}
+	if os.Getenv("AZURE_STORAGE_KEY") != "" {
+		c.Storage.Azure.AccountKeyEnv = "AZURE_STORAGE_KEY"
+	}
+
+	overrideString(&c.Storage.GCS.Endpoint, "GCS_ENDPOINT_URL")
+
+	overrideString(&c.Auth.APIKeysFile, "AUTH_API_KEYS_FILE")
+	overrideString(&c.Auth.JWT.Issuer, "AUTH_JWT_ISSUER")
+
+	overrideString(&c.Logging.Level, "LOG_LEVEL")
+	overrideString(&c.Logging.Format, "LOG_FORMAT")
+
+	return errors.Join(
+		overrideBool(&c.Server.SkipStartupCheck, "SKIP_STARTUP_CHECK"),
+		overrideFlag(&c.Storage.S3.ForcePathStyle, "S3_FORCE_PATH_STYLE"),
+		overrideFlag(&c.Storage.S3.InsecureSkipVerify, "S3_INSECURE_SKIP_VERIFY"),
+		overrideBool(&c.Tracing.Enabled, "TRACING_ENABLED"),
+	)
+}
+
+// overrideString sets dst to the first of the named environment variables that is set.
+func overrideString(dst *string, names ...string) {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			*dst = value
+			return
+		}
+	}
+}
+
+func overrideBool(dst *bool, name string) error {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: must be true or false", name, value)
+	}
+	*dst = parsed
+	return nil
+}
+
+// overrideFlag is overrideBool for the flags that tell unset from false.
+func overrideFlag(dst **bool, name string) error {
+	if os.Getenv(name) == "" {
+		return nil
+	}
+	var value bool
+	if err := overrideBool(&value, name); err != nil {
+		return err
+	}
+	*dst = &value
+	return nil
+}
+
+// validate reports every problem found in the config, each prefixed with the path of the offending field.
+func (c config) validate() error {
+	var errs []error
+	fail := func(field string, err error) {
+		errs = append(errs, fmt.Errorf("%s: %w", field, err))
+	}
+
+	if _, _, err := net.SplitHostPort(c.Server.Address); err != nil {
+		fail("server.address", fmt.Errorf("must be host:port, got %q", c.Server.Address))
+	}
+	for field, value := range map[string]time.Duration{
+		"server.readHeaderTimeout": c.Server.ReadHeaderTimeout,
+		"server.readTimeout":       c.Server.ReadTimeout,
+		"server.writeTimeout":      c.Server.WriteTimeout,
+		"server.idleTimeout":       c.Server.IdleTimeout,
+		"server.drainPeriod":       c.Server.DrainPeriod,
+		"limits.maxLogsRange":      c.Limits.MaxLogsRange,
+		"limits.maxCoverageRange":  c.Limits.MaxCoverageRange,
+		"limits.prefixTimeout":     c.Limits.PrefixTimeout,
+		"limits.queryTimeout":      c.Limits.QueryTimeout,
+		"limits.streamsTimeout":    c.Limits.StreamsTimeout,
+		"limits.coverageTimeout":   c.Limits.CoverageTimeout,
+	} {
+		if value <= 0 {
+			fail(field, fmt.Errorf("must be positive, got %s", value))
+		}
+	}
+	if c.Limits.QueryTimeout > 0 && c.Limits.PrefixTimeout > c.Limits.QueryTimeout {
+		fail("limits.prefixTimeout", fmt.Errorf("must not exceed limits.queryTimeout %s, got %s", c.Limits.QueryTimeout,
+			c.Limits.PrefixTimeout))
+	}
+	if err := c.Server.TLS.validate(); err != nil {
+		fail("server.tls", err)
+	}
+	if c.Server.ReloadInterval < 0 {
+		fail("server.reloadInterval", fmt.Errorf("must not be negative, got %s", c.Server.ReloadInterval))
+	}
+	for field, value := range map[string]time.Duration{
+		"limits.maxLogsRange":     c.Limits.MaxLogsRange,
+		"limits.maxCoverageRange": c.Limits.MaxCoverageRange,
+	} {
+		if value > 0 && value%time.Hour != 0 {
+			fail(field, fmt.Errorf("must be a whole number of hours, got %s", value))
+		}
+	}
+
+	c.validateRateLimits(fail)
+	if c.HourCache.SettleDelay < 0 {
+		fail("hourCache.settleDelay", fmt.Errorf("must not be negative, got %s", c.HourCache.SettleDelay))
+	}
+	if c.HourCache.MaxHours < 0 {
+		fail("hourCache.maxHours", fmt.Errorf("must not be negative, got %d", c.HourCache.MaxHours))
+	}
+	if c.Compression.Enabled && (c.Compression.Level < 1 || c.Compression.Level > 9) {
+		fail("compression.level", fmt.Errorf("must be between 1 and 9, got %d", c.Compression.Level))
+	}
+	if c.Compression.MinSize < 0 {
+		fail("compression.minSize", fmt.Errorf("must not be negative, got %d", c.Compression.MinSize))
+	}
+
+	hasFallback := c.Storage.Bucket != "" || c.Storage.Path != ""
+	if hasFallback {
+		if err := c.Storage.validate(); err != nil {
+			fail("storage", err)
+		}
+		if len(c.StreamPatterns) == 0 {
+			fail("streamPatterns", errors.New("must be provided to serve undeclared streams from storage, "+
+				`e.g. "hub-*-logs" (or STREAM_PATTERNS)`))
+		}
+	} else if err := c.Storage.validateOptions(); err != nil {
+		fail("storage", err)
+	}
+	for _, pattern := range c.StreamPatterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			fail("streamPatterns", fmt.Errorf("invalid pattern %q", pattern))
+		}
+	}
+
+	if err := c.Tracing.validate(); err != nil {
+		fail("tracing", err)
+	}
+	if err := c.Logging.validate(); err != nil {
+		fail("logging", err)
+	}
+	if err := c.Auth.validate(); err != nil {
+		fail("auth", err)
+	}
+	if err := c.CORS.Validate(); err != nil {
+		fail("cors", err)
+	}
+	for i, policy := range c.Auth.Policies {
+		if err := policy.Validate(); err != nil {
+			fail(fmt.Sprintf("auth.policies[%d]", i), err)
+		}
+	}
+
+	names := map[string]bool{}
+	for i, stream := range c.Streams {
+		field := fmt.Sprintf("streams[%d]", i)
+		if stream.Name == "" {
+			fail(field+".name", errors.New("must be provided"))
+		} else if err := handlers.ValidateStreamName(stream.Name); err != nil {
+			fail(field+".name", err)
+		} else {
+			field = fmt.Sprintf("streams[%d] (%s)", i, stream.Name)
+			if names[stream.Name] {
+				fail(field+".name", errors.New("is declared more than once"))
+			}
+			names[stream.Name] = true
+		}
+		opts := stream.Storage
+		opts.Backend = cmp.Or(opts.Backend, c.Storage.Backend)
+		if err := opts.validate(); err != nil {
+			fail(field, err)
+		}
+	}
+
+	if !hasFallback && len(c.Streams) == 0 {
+		errs = append(errs, errors.New("no streams configured: set storage.bucket, storage.path and/or streams "+
+			"(or S3_BUCKET, STORAGE_BUCKET, STORAGE_PATH)"))
+	}
+
+	slices.SortFunc(errs, func(a, b error) int { return cmp.Compare(a.Error(), b.Error()) })
+	return errors.Join(errs...)
+}
+
+func (c config) validateRateLimits(fail func(field string, err error)) {
+	limits := c.RateLimits
+	if limits.RequestsPerSecond < 0 {
+		fail("rateLimits.requestsPerSecond", fmt.Errorf("must not be negative, got %g", limits.RequestsPerSecond))
+	}
+	if limits.RequestsPerSecond > 0 && limits.Burst < 1 {
+		fail("rateLimits.burst", fmt.Errorf("must be at least 1, got %d", limits.Burst))
+	}
+	if limits.MaxConcurrentQueries < 0 {
+		fail("rateLimits.maxConcurrentQueries", fmt.Errorf("must not be negative, got %d", limits.MaxConcurrentQueries))
+	}
+	if limits.MaxQueuedQueries < 0 {
+		fail("rateLimits.maxQueuedQueries", fmt.Errorf("must not be negative, got %d", limits.MaxQueuedQueries))
+	}
+	if limits.MaxConcurrentQueries > 0 && limits.QueueTimeout <= 0 {
+		fail("rateLimits.queueTimeout", fmt.Errorf("must be positive, got %s", limits.QueueTimeout))
+	}
+	for _, name := range slices.Sorted(maps.Keys(limits.Streams)) {
+		field := fmt.Sprintf("rateLimits.streams[%s]", name)
+		override := limits.Streams[name]
+		if err := handlers.ValidateStreamName(name); err != nil {
+			fail(field, err)
+		}
+		if override.RequestsPerSecond <= 0 {
+			fail(field+".requestsPerSecond", fmt.Errorf("must be positive, got %g", override.RequestsPerSecond))
+		}
+		if override.Burst < 1 {
+			fail(field+".burst", fmt.Errorf("must be at least 1, got %d", override.Burst))
+		}
+	}
+}
+
+// validate checks the backend selection and the options of the selected backend.
+func (o storeOptions) validate() error {
+	backend := cmp.Or(o.Backend, backendS3)
+	if !slices.Contains(supportedBackends, backend) {
+		return fmt.Errorf("unsupported backend %q, must be one of %v", o.Backend, supportedBackends)
+	}
+	if backend == backendFilesystem && o.Path == "" {
+		return errors.New("path must be provided for the filesystem backend")
+	}
+	if backend != backendFilesystem && o.Bucket == "" {
+		return fmt.Errorf("bucket must be provided for the %s backend", backend)
+	}
+	return o.validateOptions()
+}
+
+// validateOptions checks the backend specific options, regardless of the selected backend.
+func (o storeOptions) validateOptions() error {
+	if err := o.S3.validate(); err != nil {
+		return err
+	}
+	if aws.ToBool(o.GCS.WithoutAuthentication) && o.GCS.CredentialsFile != "" {
+		return errors.New("gcs: withoutAuthentication and credentialsFile are mutually exclusive")
+	}
+	return nil
+}
+
+// writeConfig writes cfg as YAML, in the format accepted by loadConfig.
+func writeConfig(w io.Writer, cfg config) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(cfg); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// version identifies the effective configuration, so that the running version can be compared with the file.
+func (c config) version() string {
+	hash := sha256.New()
+	if err := writeConfig(hash, c); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:12]
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/handlers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var configEnv = []string{
+	"LISTEN_ADDRESS", "SKIP_STARTUP_CHECK", "STORAGE_BACKEND", "STORAGE_BUCKET", "S3_BUCKET", "STORAGE_PATH",
+	"AWS_REGION", "S3_ENDPOINT_URL", "S3_CA_BUNDLE", "S3_FORCE_PATH_STYLE", "S3_INSECURE_SKIP_VERIFY",
+	"AZURE_STORAGE_ACCOUNT", "AZURE_STORAGE_BLOB_ENDPOINT", "AZURE_STORAGE_CONNECTION_STRING", "AZURE_STORAGE_KEY",
+	"GCS_ENDPOINT_URL", "TRACING_ENABLED", "LOG_LEVEL", "LOG_FORMAT", "AUTH_API_KEYS_FILE", "AUTH_JWT_ISSUER", "STREAM_PATTERNS",
+	"CORS_ALLOWED_ORIGINS",
+	"TLS_CERT_FILE", "TLS_KEY_FILE", "TLS_CLIENT_CA_FILE",
+}
+
+// clearConfigEnv keeps the environment of the test process from overriding the config under test.
+func clearConfigEnv(t *testing.T) {
+	t.Helper()
+	for _, name := range configEnv {
+		t.Setenv(name, "")
+	}
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	clearConfigEnv(t)
+	path := writeConfigFile(t, `
+server:
+  address: ":8080"
+  writeTimeout: 3m
+storage:
+  region: us-west-2
+limits:
+  maxLogsRange: 12h
+streams:
+  - name: audit-logs
+    bucket: mdai-audit-logs
+    region: eu-west-1
+    forcePathStyle: true
+    credentials:
+      accessKeyIdEnv: AUDIT_KEY
+      secretAccessKeyEnv: AUDIT_SECRET
+  - name: local-logs
+    backend: filesystem
+    path: /data/bucket
+    prefixTemplate: "exports/{stream}/{year}/{month}/{day}/{hour}/"
+`)
+
+	cfg, err := loadConfig(path)
+	require.NoError(t, err)
+
+	expected := defaultConfig()
+	expected.Server.Address = ":8080"
+	expected.Server.WriteTimeout = 3 * time.Minute
+	expected.Storage = storeOptions{S3: s3Options{Region: "us-west-2"}}
+	expected.Limits.MaxLogsRange = 12 * time.Hour
+	expected.Streams = []streamConfig{
+		{
+			Name: "audit-logs",
+			Storage: storeOptions{
+				Bucket: "mdai-audit-logs",
+				S3: s3Options{
+					Region:         "eu-west-1",
+					ForcePathStyle: aws.Bool(true),
+					Credentials:    credentialsConfig{AccessKeyIDEnv: "AUDIT_KEY", SecretAccessKeyEnv: "AUDIT_SECRET"},
+				},
+			},
+		},
+		{
+			Name:           "local-logs",
+			PrefixTemplate: "exports/{stream}/{year}/{month}/{day}/{hour}/",
+			Storage:        storeOptions{Backend: backendFilesystem, Path: "/data/bucket"},
+		},
+	}
+	assert.Equal(t, expected, cfg)
+}
+
+func TestLoadConfigEnvOverrides(t *testing.T) {
+	clearConfigEnv(t)
+	path := writeConfigFile(t, `
+server:
+  address: ":8080"
+storage:
+  bucket: from-file
+  region: us-west-2
+`)
+	t.Setenv("LISTEN_ADDRESS", "127.0.0.1:9090")
+	t.Setenv("S3_BUCKET", "from-env")
+	t.Setenv("S3_FORCE_PATH_STYLE", "true")
+	t.Setenv("SKIP_STARTUP_CHECK", "true")
+	t.Setenv("STREAM_PATTERNS", "hub-*-logs, audit-*")
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://grafana.example.com,https://tools.example.com")
+
+	cfg, err := loadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"hub-*-logs", "audit-*"}, cfg.StreamPatterns)
+	assert.Equal(t, []string{"https://grafana.example.com", "https://tools.example.com"}, cfg.CORS.AllowedOrigins)
+	assert.Equal(t, "127.0.0.1:9090", cfg.Server.Address)
+	assert.True(t, cfg.Server.SkipStartupCheck)
+	assert.Equal(t, storeOptions{
+		Bucket: "from-env",
+		S3:     s3Options{Region: "us-west-2", ForcePathStyle: aws.Bool(true)},
+	}, cfg.Storage)
+
+	t.Setenv("S3_FORCE_PATH_STYLE", "yes please")
+	_, err = loadConfig(path)
+	require.EqualError(t, err, `invalid S3_FORCE_PATH_STYLE "yes please": must be true or false`)
+}
+
+func TestLoadConfigWithoutFile(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv("STORAGE_BACKEND", backendFilesystem)
+	t.Setenv("STORAGE_PATH", "/data/bucket")
+	t.Setenv("STREAM_PATTERNS", "*")
+
+	cfg, err := loadConfig("")
+	require.NoError(t, err)
+	assert.Equal(t, defaultListenAddress, cfg.Server.Address)
+	assert.Equal(t, handlers.DefaultLimits(), cfg.Limits)
+	assert.Equal(t, storeOptions{Backend: backendFilesystem, Path: "/data/bucket"}, cfg.Storage)
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name:    "unknown field",
+			content: "server:\n  adress: \":8080\"\n",
+			wantErr: "parsing config",
+		},
+		{
+			name:    "invalid duration",
+			content: "limits:\n  maxLogsRange: four hours\n",
+			wantErr: "parsing config",
+		},
+		{
+			name:    "no streams",
+			content: "server:\n  address: \":8080\"\n",
+			wantErr: "invalid config: no streams configured: set storage.bucket, storage.path and/or streams " +
+				"(or S3_BUCKET, STORAGE_BUCKET, STORAGE_PATH)",
+		},
+		{
+			name:    "policies without authentication",
+			content: "storage:\n  bucket: logs\nauth:\n  policies:\n    - streams: [audit]\n",
+			wantErr: "invalid config: auth.policies[0]: principals or claims must be provided\n" +
+				"auth: policies require apiKeysFile or jwt to authenticate principals",
+		},
+		{
+			name: "client auth without client CA",
+			content: "storage:\n  bucket: logs\nstreamPatterns: ['*']\n" +
+				"server:\n  tls:\n    certFile: /etc/tls/tls.crt\n    keyFile: /etc/tls/tls.key\n    clientAuth: require\n",
+			wantErr: "invalid config: server.tls: clientAuth requires clientCAFile",
+		},
+		{
+			name: "every problem is reported",
+			content: `
+server:
+  address: "8080"
+  readTimeout: -1s
+  tls:
+    certFile: /etc/tls/tls.crt
+    minVersion: "1.1"
+limits:
+  maxLogsRange: 90m
+  prefixTimeout: 10m
+compression:
+  level: 12
+cors:
+  allowedOrigins: ["*", "grafana.example.com"]
+  allowCredentials: true
+hourCache:
+  settleDelay: -5m
+rateLimits:
+  requestsPerSecond: 5
+  burst: 0
+  streams:
+    audit:
+      requestsPerSecond: 0
+      burst: 1
+storage:
+  bucket: logs
+  endpoint: minio:9000
+streamPatterns: ["hub-["]
+streams:
+  - name: audit
+    backend: ftp
+  - name: audit
+    backend: filesystem
+    path: /data
+  - bucket: logs
+tracing:
+  endpoint: collector:4318
+  sampleRatio: 2
+logging:
+  level: verbose
+auth:
+  jwt:
+    audience: mdai-s3-logs-reader
+`,
+			wantErr: "invalid config: auth: jwt: issuer or jwksFile must be provided\n" +
+				"compression.level: must be between 1 and 9, got 12\n" +
+				"cors: allowedOrigins: \"*\" cannot be used with allowCredentials\n" +
+				"allowedOrigins: invalid origin \"grafana.example.com\", must be scheme://host[:port]\n" +
+				"hourCache.settleDelay: must not be negative, got -5m0s\n" +
+				"limits.maxLogsRange: must be a whole number of hours, got 1h30m0s\n" +
+				"limits.prefixTimeout: must not exceed limits.queryTimeout 5m0s, got 10m0s\n" +
+				"logging: invalid level \"verbose\", must be one of debug, info, warn or error\n" +
+				"rateLimits.burst: must be at least 1, got 0\n" +
+				"rateLimits.streams[audit].requestsPerSecond: must be positive, got 0\n" +
+				"server.address: must be host:port, got \"8080\"\n" +
+				"server.readTimeout: must be positive, got -1s\n" +
+				"server.tls: certFile and keyFile must be provided together\n" +
+				"invalid minVersion \"1.1\", must be 1.2 or 1.3\n" +
+				"storage: invalid endpoint \"minio:9000\": must be an absolute http(s) URL\n" +
+				"streamPatterns: invalid pattern \"hub-[\"\n" +
+				"streams[0] (audit): unsupported backend \"ftp\", must be one of [s3 filesystem azure gcs]\n" +
+				"streams[1] (audit).name: is declared more than once\n" +
+				"streams[2].name: must be provided\n" +
+				"tracing: invalid endpoint \"collector:4318\": must be an absolute http(s) URL\n" +
+				"sampleRatio must be between 0 and 1, got 2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearConfigEnv(t)
+			_, err := loadConfig(writeConfigFile(t, tt.content))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestWriteConfig(t *testing.T) {
+	clearConfigEnv(t)
+	cfg := defaultConfig()
+	cfg.Storage = storeOptions{Bucket: "logs", S3: s3Options{Region: "eu-west-1"}}
+	cfg.StreamPatterns = []string{"hub-*-logs"}
+	cfg.Streams = []streamConfig{{Name: "local", Storage: storeOptions{Backend: backendFilesystem, Path: "/data"}}}
+
+	var buf bytes.Buffer
+	require.NoError(t, writeConfig(&buf, cfg))
+	assert.Contains(t, buf.String(), "readHeaderTimeout: 5s")
+	assert.NotContains(t, buf.String(), "azure", "unused backend options are omitted")
+
+	reloaded, err := loadConfig(writeConfigFile(t, buf.String()))
+	require.NoError(t, err)
+	assert.Equal(t, cfg, reloaded)
+}
+
+func TestLoadConfigStreamsInheritBackend(t *testing.T) {
+	clearConfigEnv(t)
+	dir := t.TempDir()
+	path := writeConfigFile(t, `
+storage:
+  backend: filesystem
+streams:
+  - name: local
+    path: `+dir+`
+  - name: audit
+    backend: gcs
+    bucket: mdai-audit-logs
+    gcs:
+      endpoint: http://127.0.0.1:4443/storage/v1/
+      withoutAuthentication: true
+`)
+
+	cfg, err := loadConfig(path)
+	require.NoError(t, err, "streams without a backend use storage.backend")
+	registry, err := newRegistry(t.Context(), newStoreFactory(), cfg)
+	require.NoError(t, err)
+	local, ok := registry.Lookup("local")
+	require.True(t, ok)
+	assert.Equal(t, "file://"+filepath.ToSlash(dir), local.Store.Location())
+	audit, ok := registry.Lookup("audit")
+	require.True(t, ok)
+	assert.Equal(t, "gs://mdai-audit-logs", audit.Store.Location())
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+)
+
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+var logFormats = []string{logFormatText, logFormatJSON}
+
+// logLevel is shared by the installed handler, so that reloading the config can change it.
+var logLevel slog.LevelVar
+
+type loggingConfig struct {
+	// Level is debug, info, warn or error.
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+func (c loggingConfig) level() (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Level)); err != nil {
+		return 0, fmt.Errorf("invalid level %q, must be one of debug, info, warn or error", c.Level)
+	}
+	return level, nil
+}
+
+func (c loggingConfig) validate() error {
+	if _, err := c.level(); err != nil {
+		return err
+	}
+	if !slices.Contains(logFormats, c.Format) {
+		return fmt.Errorf("unsupported format %q, must be one of %v", c.Format, logFormats)
+	}
+	return nil
+}
+
+// setupLogging installs the default slog logger. Remaining uses of the log package, i.e. fatal startup errors, are
+// logged at error level.
+func setupLogging(w io.Writer, cfg loggingConfig) {
+	level, _ := cfg.level()
+	logLevel.Set(level)
+
+	opts := &slog.HandlerOptions{Level: &logLevel}
+	var handler slog.Handler = slog.NewTextHandler(w, opts)
+	if cfg.Format == logFormatJSON {
+		handler = slog.NewJSONHandler(w, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+	slog.SetLogLoggerLevel(slog.LevelError)
+}
@@ -2,50 +2,156 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/decisiveai/mdai-s3-logs-reader/internal/handlers"
 )
 
 const (
-	defaultReadHeaderTimeout = 5 * time.Second
-	defaultReadTimeout       = 10 * time.Second
-	defaultWriteTimeout      = 10 * time.Second
-	defaultIdleTimeout       = 120 * time.Second
-	defaultHTTPPort          = "4400"
+	startupCheckTimeout = 30 * time.Second
+	tracingFlushTimeout = 5 * time.Second
 )
 
 func main() {
-	s3Bucket := os.Getenv("S3_BUCKET")
-	s3Region := os.Getenv("AWS_REGION")
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"),
+		"path of the YAML config file, defaults to $CONFIG_FILE")
+	printConfig := flag.Bool("print-config", false, "print the effective configuration and exit")
+	flag.Parse()
 
-	cfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithRegion(os.Getenv(s3Region)),
-		config.WithClientLogMode(aws.LogRetries),
-	)
+	cfg, err := loadConfig(*configPath)
 	if err != nil {
-		log.Fatal("unable to load SDK config, ", err)
+		log.Fatal(err)
 	}
+	setupLogging(os.Stderr, cfg.Logging)
 
-	s3Client := s3.NewFromConfig(cfg)
+	if *printConfig {
+		if err := writeConfig(os.Stdout, cfg); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if err := run(*configPath, cfg); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run serves until SIGTERM or SIGINT, then drains in-flight requests and flushes the buffered spans.
+func run(configPath string, cfg config) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	shutdownTracing, err := setupTracing(ctx, cfg.Tracing)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		flushCtx, cancel := context.WithTimeout(context.Background(), tracingFlushTimeout)
+		defer cancel()
+		if err := shutdownTracing(flushCtx); err != nil {
+			slog.Warn("flushing traces", "error", err)
+		}
+	}()
+
+	stores := newStoreFactory()
+	settings, err := newSettings(ctx, stores, cfg)
+	if err != nil {
+		return fmt.Errorf("invalid stream configuration: %w", err)
+	}
+	stores.commit()
+
+	if !cfg.Server.SkipStartupCheck {
+		if err := checkStores(ctx, settings.Registry); err != nil {
+			return fmt.Errorf("startup check failed: %w", err)
+		}
+	}
+
+	rt := handlers.NewRuntime(settings)
+	go newReloader(configPath, cfg, rt, stores).run(ctx, cfg.Server.ReloadInterval)
 
-	r := handlers.NewRouter(s3Client, s3Bucket)
+	r := handlers.NewRuntimeRouter(rt)
 
 	srv := &http.Server{
-		Addr:              ":" + defaultHTTPPort, // Grafana uses port 3000, so making port 4400
-		Handler:           r,
-		ReadTimeout:       defaultReadTimeout,
-		WriteTimeout:      defaultWriteTimeout,
-		IdleTimeout:       defaultIdleTimeout,
-		ReadHeaderTimeout: defaultReadHeaderTimeout,
+		Handler:           traceHandler(handlers.AccessLog(handlers.Compress(cfg.Compression)(handlers.AllowCORS(cfg.CORS)(r)))),
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
 	}
+	if cfg.Server.TLS.enabled() {
+		certs, err := newCertificates(cfg.Server.TLS)
+		if err != nil {
+			return fmt.Errorf("tls: %w", err)
+		}
+		srv.TLSConfig = certs.serverConfig()
+	}
+
+	listener, err := (&net.ListenConfig{}).Listen(ctx, "tcp", cfg.Server.Address)
+	if err != nil {
+		return err
+	}
+	slog.Info("listening", "address", listener.Addr().String(), "tls", srv.TLSConfig != nil,
+		"mtls", cfg.Server.TLS.ClientCAFile != "", "config_version", settings.Version)
+	return serve(ctx, srv, listener, cfg.Server.DrainPeriod)
+}
+
+// serve runs srv on listener, over TLS when srv has a TLS config, until ctx is done. It then stops accepting
+// connections and waits up to drainPeriod for in-flight requests, canceling the context of those still running
+// afterwards so that their storage calls stop.
+func serve(ctx context.Context, srv *http.Server, listener net.Listener, drainPeriod time.Duration) error {
+	requestsCtx, cancelRequests := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelRequests()
+	srv.BaseContext = func(net.Listener) context.Context { return requestsCtx }
+
+	served := make(chan error, 1)
+	go func() {
+		if srv.TLSConfig != nil {
+			served <- srv.ServeTLS(listener, "", "")
+			return
+		}
+		served <- srv.Serve(listener)
+	}()
 
-	log.Println("Listening on :4400")
-	log.Fatal(srv.ListenAndServe())
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down, draining in-flight requests", "drain_period", drainPeriod.String())
+	drainCtx, cancel := context.WithTimeout(context.Background(), drainPeriod)
+	defer cancel()
+	if err := srv.Shutdown(drainCtx); err != nil {
+		slog.Warn("drain period elapsed, canceling in-flight requests", "error", err)
+		cancelRequests()
+		return srv.Close()
+	}
+	slog.Info("drained in-flight requests")
+	return nil
+}
+
+// checkStores fails fast on unreachable stores, e.g. because of a wrong endpoint, region or credentials.
+func checkStores(ctx context.Context, registry *handlers.Registry) error {
+	ctx, cancel := context.WithTimeout(ctx, startupCheckTimeout)
+	defer cancel()
+
+	var errs []error
+	for _, check := range handlers.CheckStores(ctx, registry).Stores {
+		if check.Error != "" {
+			errs = append(errs, fmt.Errorf("%s is not reachable: %s", check.Location, check.Error))
+			continue
+		}
+		slog.Info("store is reachable", "location", check.Location, "duration_ms", check.DurationMs)
+	}
+	return errors.Join(errs...)
 }
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeDrainsInFlightRequests(t *testing.T) {
+	tests := []struct {
+		name         string
+		drainPeriod  time.Duration
+		handlerDelay time.Duration
+		wantCanceled bool
+	}{
+		{name: "CompletesWithinDrainPeriod", drainPeriod: 5 * time.Second, handlerDelay: 100 * time.Millisecond},
+		{name: "CanceledAfterDrainPeriod", drainPeriod: 100 * time.Millisecond, handlerDelay: time.Minute, wantCanceled: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			started := make(chan struct{})
+			canceled := make(chan bool, 1)
+			srv := &http.Server{
+				ReadHeaderTimeout: time.Second,
+				Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					close(started)
+					select {
+					case <-time.After(tt.handlerDelay):
+						canceled <- false
+						_, _ = io.WriteString(w, "done")
+					case <-r.Context().Done():
+						canceled <- true
+					}
+				}),
+			}
+
+			listener, err := (&net.ListenConfig{}).Listen(t.Context(), "tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+
+			ctx, stop := context.WithCancel(t.Context())
+			served := make(chan error, 1)
+			go func() { served <- serve(ctx, srv, listener, tt.drainPeriod) }()
+
+			responded := make(chan string, 1)
+			go func() {
+				req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://"+listener.Addr().String(), http.NoBody)
+				resp, err := http.DefaultClient.Do(req)
+				if err != nil {
+					responded <- ""
+					return
+				}
+				defer resp.Body.Close()
+				body, _ := io.ReadAll(resp.Body)
+				responded <- string(body)
+			}()
+
+			<-started
+			stop()
+
+			require.NoError(t, <-served)
+			assert.Equal(t, tt.wantCanceled, <-canceled)
+			if !tt.wantCanceled {
+				assert.Equal(t, "done", <-responded, "the in-flight request completes")
+			}
+
+			_, err = net.DialTimeout("tcp", listener.Addr().String(), time.Second)
+			assert.Error(t, err, "no new connections are accepted")
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/handlers"
+)
+
+// reloader swaps the streams, limits and credentials of the running server when the config file or the secret files
+// it refers to change, or on SIGHUP. Invalid configurations are rejected and the current one stays active. Server
+// settings only take effect after a restart.
+type reloader struct {
+	path    string
+	runtime *handlers.Runtime
+	stores  *storeFactory
+	current config
+	// file is the content of the config file the last reload was attempted with.
+	file []byte
+	// secrets is the content of the API keys and JWKS files the last reload was attempted with.
+	secrets map[string][]byte
+}
+
+func newReloader(path string, cfg config, rt *handlers.Runtime, stores *storeFactory) *reloader {
+	r := &reloader{path: path, runtime: rt, stores: stores, current: cfg, secrets: readFiles(cfg.Auth.files())}
+	if path != "" {
+		r.file, _ = os.ReadFile(path)
+	}
+	return r
+}
+
+// readFiles returns the content of the files that can be read.
+func readFiles(paths []string) map[string][]byte {
+	files := make(map[string][]byte, len(paths))
+	for _, path := range paths {
+		if data, err := os.ReadFile(path); err == nil {
+			files[path] = data
+		}
+	}
+	return files
+}
+
+// newSettings builds the settings of cfg with stores from factory. The caller commits or discards the stores.
+func newSettings(ctx context.Context, stores *storeFactory, cfg config) (handlers.Settings, error) {
+	registry, err := newRegistry(ctx, stores, cfg)
+	if err != nil {
+		return handlers.Settings{}, err
+	}
+	authenticator, err := newAuthenticator(cfg.Auth)
+	if err != nil {
+		return handlers.Settings{}, fmt.Errorf("auth: %w", err)
+	}
+	return handlers.Settings{
+		Registry:      registry,
+		Limits:        cfg.Limits,
+		Authenticator: authenticator,
+		RateLimits:    cfg.RateLimits,
+		HourCache:     cfg.HourCache,
+		Policies:      cfg.Auth.Policies,
+		Version:       cfg.version(),
+		LoadedAt:      time.Now().UTC(),
+	}, nil
+}
+
+// run reloads on SIGHUP, and whenever the config file changes if interval is positive, until ctx is done.
+func (r *reloader) run(ctx context.Context, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if interval > 0 && r.path != "" {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			slog.Info("received SIGHUP, reloading config")
+			_ = r.reload(ctx)
+		case <-tick:
+			r.reloadIfChanged(ctx)
+		}
+	}
+}
+
+// reloadIfChanged reloads when the content of the config file or of a secret file differs from the last attempt.
+// Comparing the content rather than the modification time also catches ConfigMap and Secret updates, which swap a
+// symlink.
+func (r *reloader) reloadIfChanged(ctx context.Context) {
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		slog.Error("reading config", "path", r.path, "error", err)
+		return
+	}
+	if !bytes.Equal(data, r.file) {
+		slog.Info("config changed, reloading", "path", r.path)
+		_ = r.reload(ctx)
+		return
+	}
+	for path, secret := range r.secrets {
+		if data, err := os.ReadFile(path); err == nil && !bytes.Equal(data, secret) {
+			slog.Info("secret changed, reloading", "path", path)
+			_ = r.reload(ctx)
+			return
+		}
+	}
+}
+
+func (r *reloader) reload(ctx context.Context) error {
+	if r.path != "" {
+		r.file, _ = os.ReadFile(r.path)
+	}
+
+	cfg, err := loadConfig(r.path)
+	if err != nil {
+		return r.reject(err)
+	}
+	r.secrets = readFiles(cfg.Auth.files())
+	settings, err := newSettings(ctx, r.stores, cfg)
+	if err != nil {
+		r.stores.discard()
+		return r.reject(err)
+	}
+
+	if cfg.Server != r.current.Server || cfg.Tracing != r.current.Tracing || cfg.Logging.Format != r.current.Logging.Format {
+		slog.Warn("server, tracing or log format settings changed, restart to apply them")
+	}
+	if level, err := cfg.Logging.level(); err == nil {
+		logLevel.Set(level)
+	}
+	closeUnused := r.stores.commit()
+	replaced := r.runtime.Swap(settings)
+	go func() {
+		<-replaced
+		closeUnused()
+	}()
+	r.current = cfg
+	slog.Info("loaded config", "version", settings.Version)
+	return nil
+}
+
+func (r *reloader) reject(err error) error {
+	slog.Error("rejected config", "path", r.path, "active_version", r.runtime.Settings().Version, "error", err)
+	r.runtime.RecordReloadError(time.Now().UTC(), err)
+	return err
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/auth"
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/handlers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloader(t *testing.T) {
+	clearConfigEnv(t)
+	dir := t.TempDir()
+	path := writeConfigFile(t, "streams:\n  - name: audit\n    backend: filesystem\n    path: "+dir+"\n")
+
+	cfg, err := loadConfig(path)
+	require.NoError(t, err)
+	stores := newStoreFactory()
+	settings, err := newSettings(t.Context(), stores, cfg)
+	require.NoError(t, err)
+	rt := handlers.NewRuntime(settings)
+	r := newReloader(path, cfg, rt, stores)
+
+	r.reloadIfChanged(t.Context())
+	assert.Equal(t, settings.Version, rt.Status().ConfigVersion)
+	assert.True(t, rt.Status().LastReloadAttempt.IsZero(), "an unchanged file is not reloaded")
+
+	require.NoError(t, os.WriteFile(path, []byte(`
+limits:
+  maxLogsRange: 8h
+streams:
+  - name: audit
+    backend: filesystem
+    path: `+dir+`
+  - name: billing
+    backend: filesystem
+    path: `+dir+`
+`), 0o600))
+	r.reloadIfChanged(t.Context())
+
+	reloaded := rt.Settings()
+	assert.NotEqual(t, settings.Version, reloaded.Version)
+	assert.Equal(t, 8*time.Hour, reloaded.Limits.MaxLogsRange)
+	_, ok := reloaded.Registry.Lookup("billing")
+	assert.True(t, ok)
+
+	require.NoError(t, os.WriteFile(path, []byte("limits:\n  maxLogsRange: -1h\n"), 0o600))
+	r.reloadIfChanged(t.Context())
+
+	status := rt.Status()
+	assert.Equal(t, reloaded.Version, status.ConfigVersion, "an invalid config keeps the current one active")
+	assert.Contains(t, status.LastReloadError, "limits.maxLogsRange: must be positive, got -1h0m0s")
+	assert.Same(t, reloaded, rt.Settings())
+}
+
+func TestReloaderRotatesAPIKeys(t *testing.T) {
+	clearConfigEnv(t)
+	dir := t.TempDir()
+	keysPath := filepath.Join(dir, "api-keys")
+	require.NoError(t, os.WriteFile(keysPath, []byte("grafana:old\n"), 0o600))
+	path := writeConfigFile(t, "auth:\n  apiKeysFile: "+keysPath+"\nstorage:\n  backend: filesystem\n  path: "+dir+"\nstreamPatterns: [\"*\"]\n")
+
+	cfg, err := loadConfig(path)
+	require.NoError(t, err)
+	stores := newStoreFactory()
+	settings, err := newSettings(t.Context(), stores, cfg)
+	require.NoError(t, err)
+	rt := handlers.NewRuntime(settings)
+	r := newReloader(path, cfg, rt, stores)
+
+	authenticate := func(key string) error {
+		req := httptest.NewRequest(http.MethodGet, "/streams", http.NoBody)
+		req.Header.Set(auth.APIKeyHeader, key)
+		_, err := rt.Settings().Authenticator.Authenticate(req)
+		return err
+	}
+	require.NoError(t, authenticate("old"))
+
+	require.NoError(t, os.WriteFile(keysPath, []byte("grafana:new\n"), 0o600))
+	r.reloadIfChanged(t.Context())
+	require.NoError(t, authenticate("new"))
+	require.ErrorIs(t, authenticate("old"), auth.ErrInvalidCredentials)
+}
+
+func TestReloaderReusesStores(t *testing.T) {
+	clearConfigEnv(t)
+	dir, otherDir := t.TempDir(), t.TempDir()
+	streams := func(dirs ...string) string {
+		content := "streams:\n"
+		for i, d := range dirs {
+			content += "  - name: stream-" + strconv.Itoa(i) + "\n    backend: filesystem\n    path: " + d + "\n"
+		}
+		return content
+	}
+	path := writeConfigFile(t, streams(dir))
+
+	cfg, err := loadConfig(path)
+	require.NoError(t, err)
+	stores := newStoreFactory()
+	settings, err := newSettings(t.Context(), stores, cfg)
+	require.NoError(t, err)
+	stores.commit()
+	rt := handlers.NewRuntime(settings)
+	r := newReloader(path, cfg, rt, stores)
+	initial, ok := settings.Registry.Lookup("stream-0")
+	require.True(t, ok)
+
+	require.NoError(t, os.WriteFile(path, []byte(streams(dir, otherDir)), 0o600))
+	require.NoError(t, r.reload(t.Context()))
+	reloaded, ok := rt.Settings().Registry.Lookup("stream-0")
+	require.True(t, ok)
+	assert.Same(t, initial.Store, reloaded.Store, "unchanged stores are reused")
+
+	require.NoError(t, os.WriteFile(path, []byte(streams(t.TempDir(), filepath.Join(dir, "missing"))), 0o600))
+	require.ErrorContains(t, r.reload(t.Context()), "opening storage directory")
+	require.NoError(t, initial.Store.Check(t.Context()), "a rejected config keeps the current stores open")
+
+	require.NoError(t, os.WriteFile(path, []byte(streams(otherDir)), 0o600))
+	require.NoError(t, r.reload(t.Context()))
+	assert.Eventually(t, func() bool {
+		return initial.Store.Check(t.Context()) != nil
+	}, time.Second, 10*time.Millisecond, "stores no longer used are closed")
+}
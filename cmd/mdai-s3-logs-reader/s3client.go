@@ -0,0 +1,179 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// customEndpointRegion is used with custom endpoints such as MinIO, which accept any region.
+const customEndpointRegion = "us-east-1"
+
+// s3Options configures how an S3 client reaches its buckets. Unset values are inherited from the storage section;
+// the flags are pointers so that a stream can turn off a flag the storage section turns on.
+type s3Options struct {
+	Region             string            `yaml:"region,omitempty"`
+	Endpoint           string            `yaml:"endpoint,omitempty"`
+	ForcePathStyle     *bool             `yaml:"forcePathStyle,omitempty"`
+	InsecureSkipVerify *bool             `yaml:"insecureSkipVerify,omitempty"`
+	CABundle           string            `yaml:"caBundle,omitempty"`
+	Credentials        credentialsConfig `yaml:"credentials,omitempty"`
+}
+
+// flagValues backs the flags of merged options, so that options with the same flags compare equal as map keys.
+var flagValues = [2]bool{false, true}
+
+// sharedFlag returns a pointer to the value of set, shared by every set flag with this value, or nil when unset.
+func sharedFlag(set *bool) *bool {
+	if set == nil {
+		return nil
+	}
+	if *set {
+		return &flagValues[1]
+	}
+	return &flagValues[0]
+}
+
+// credentialsConfig references credentials by environment variable name, so that secrets stay out of the file.
+// Streams without credentials use the default AWS credential chain.
+type credentialsConfig struct {
+	Profile            string `yaml:"profile,omitempty"`
+	AccessKeyIDEnv     string `yaml:"accessKeyIdEnv,omitempty"`
+	SecretAccessKeyEnv string `yaml:"secretAccessKeyEnv,omitempty"`
+	SessionTokenEnv    string `yaml:"sessionTokenEnv,omitempty"`
+}
+
+// merge fills the unset fields of o from defaults.
+func (o s3Options) merge(defaults s3Options) s3Options {
+	if o.Region == "" {
+		o.Region = defaults.Region
+	}
+	if o.Endpoint == "" {
+		o.Endpoint = defaults.Endpoint
+	}
+	if o.CABundle == "" {
+		o.CABundle = defaults.CABundle
+	}
+	if o.Credentials == (credentialsConfig{}) {
+		o.Credentials = defaults.Credentials
+	}
+	o.ForcePathStyle = sharedFlag(cmp.Or(o.ForcePathStyle, defaults.ForcePathStyle))
+	o.InsecureSkipVerify = sharedFlag(cmp.Or(o.InsecureSkipVerify, defaults.InsecureSkipVerify))
+	return o
+}
+
+func (o s3Options) validate() error {
+	if o.Endpoint != "" {
+		endpoint, err := url.Parse(o.Endpoint)
+		if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+			return fmt.Errorf("invalid endpoint %q: must be an absolute http(s) URL", o.Endpoint)
+		}
+	}
+	if aws.ToBool(o.InsecureSkipVerify) && o.CABundle != "" {
+		return errors.New("insecureSkipVerify and caBundle are mutually exclusive")
+	}
+	if (o.Credentials.AccessKeyIDEnv == "") != (o.Credentials.SecretAccessKeyEnv == "") {
+		return errors.New("accessKeyIdEnv and secretAccessKeyEnv must be provided together")
+	}
+	return nil
+}
+
+func newS3Client(ctx context.Context, opts s3Options) (*s3.Client, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	loadOpts := []func(*awsconfig.LoadOptions) error{
+		awsconfig.WithClientLogMode(aws.LogRetries),
+	}
+	if opts.Region != "" {
+		loadOpts = append(loadOpts, awsconfig.WithRegion(opts.Region))
+	}
+	if opts.Credentials.Profile != "" {
+		loadOpts = append(loadOpts, awsconfig.WithSharedConfigProfile(opts.Credentials.Profile))
+	}
+	if opts.Credentials.AccessKeyIDEnv != "" {
+		provider, err := staticCredentials(opts.Credentials)
+		if err != nil {
+			return nil, err
+		}
+		loadOpts = append(loadOpts, awsconfig.WithCredentialsProvider(provider))
+	}
+	if aws.ToBool(opts.InsecureSkipVerify) || opts.CABundle != "" {
+		tlsConfig, err := newTLSConfig(opts)
+		if err != nil {
+			return nil, err
+		}
+		loadOpts = append(loadOpts, awsconfig.WithHTTPClient(awshttp.NewBuildableClient().WithTransportOptions(func(tr *http.Transport) {
+			tr.TLSClientConfig = tlsConfig
+		})))
+	}
+
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, loadOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load SDK config: %w", err)
+	}
+	if cfg.Region == "" {
+		if opts.Endpoint == "" {
+			return nil, errors.New("region must be set, e.g. with AWS_REGION")
+		}
+		cfg.Region = customEndpointRegion
+	}
+
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if opts.Endpoint != "" {
+			o.BaseEndpoint = aws.String(opts.Endpoint)
+		}
+		o.UsePathStyle = aws.ToBool(opts.ForcePathStyle)
+	}), nil
+}
+
+func newTLSConfig(opts s3Options) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: aws.ToBool(opts.InsecureSkipVerify), //nolint:gosec // explicitly requested for self-signed development endpoints
+	}
+	if opts.CABundle == "" {
+		return tlsConfig, nil
+	}
+
+	pem, err := os.ReadFile(opts.CABundle)
+	if err != nil {
+		return nil, fmt.Errorf("reading CA bundle: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("CA bundle %s contains no PEM certificates", opts.CABundle)
+	}
+	tlsConfig.RootCAs = pool
+	return tlsConfig, nil
+}
+
+func staticCredentials(creds credentialsConfig) (credentials.StaticCredentialsProvider, error) {
+	accessKeyID := os.Getenv(creds.AccessKeyIDEnv)
+	secretAccessKey := os.Getenv(creds.SecretAccessKeyEnv)
+	if accessKeyID == "" || secretAccessKey == "" {
+		return credentials.StaticCredentialsProvider{}, fmt.Errorf("environment variables %s and %s must be set", creds.AccessKeyIDEnv, creds.SecretAccessKeyEnv)
+	}
+
+	var sessionToken string
+	if creds.SessionTokenEnv != "" {
+		sessionToken = os.Getenv(creds.SessionTokenEnv)
+	}
+	return credentials.NewStaticCredentialsProvider(accessKeyID, secretAccessKey, sessionToken), nil
+}
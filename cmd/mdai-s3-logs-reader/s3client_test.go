@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestS3OptionsMerge(t *testing.T) {
+	defaults := s3Options{
+		Region:         "us-east-1",
+		Endpoint:       "http://minio.minio:9000",
+		ForcePathStyle: aws.Bool(true),
+		Credentials:    credentialsConfig{Profile: "default"},
+	}
+
+	merged := s3Options{Region: "eu-west-1", CABundle: "/etc/ssl/minio.pem"}.merge(defaults)
+	assert.Equal(t, s3Options{
+		Region:         "eu-west-1",
+		Endpoint:       "http://minio.minio:9000",
+		ForcePathStyle: aws.Bool(true),
+		CABundle:       "/etc/ssl/minio.pem",
+		Credentials:    credentialsConfig{Profile: "default"},
+	}, merged)
+}
+
+func TestS3OptionsMergeOverridesFlags(t *testing.T) {
+	defaults := s3Options{ForcePathStyle: aws.Bool(true), InsecureSkipVerify: aws.Bool(true)}
+
+	merged := s3Options{ForcePathStyle: aws.Bool(false), InsecureSkipVerify: aws.Bool(false)}.merge(defaults)
+	assert.False(t, aws.ToBool(merged.ForcePathStyle))
+	assert.False(t, aws.ToBool(merged.InsecureSkipVerify))
+
+	inherited := s3Options{}.merge(defaults)
+	assert.True(t, aws.ToBool(inherited.ForcePathStyle))
+	assert.True(t, aws.ToBool(inherited.InsecureSkipVerify))
+	again := s3Options{}.merge(s3Options{ForcePathStyle: aws.Bool(true), InsecureSkipVerify: aws.Bool(true)})
+	assert.True(t, inherited == again, "merged options with the same flags must compare equal as map keys")
+}
+
+func TestS3OptionsValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		opts s3Options
+		err  string
+	}{
+		{name: "Empty", opts: s3Options{}},
+		{name: "Endpoint", opts: s3Options{Endpoint: "https://minio.local:9000"}},
+		{name: "RelativeEndpoint", opts: s3Options{Endpoint: "minio:9000"}, err: `invalid endpoint "minio:9000": must be an absolute http(s) URL`},
+		{name: "InsecureWithCA", opts: s3Options{InsecureSkipVerify: aws.Bool(true), CABundle: "ca.pem"}, err: "insecureSkipVerify and caBundle are mutually exclusive"},
+		{name: "PartialCredentials", opts: s3Options{Credentials: credentialsConfig{AccessKeyIDEnv: "KEY"}}, err: "accessKeyIdEnv and secretAccessKeyEnv must be provided together"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.validate()
+			if tt.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestNewS3ClientCustomEndpoint(t *testing.T) {
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_CONFIG_FILE", "/dev/null")
+	t.Setenv("TEST_ACCESS_KEY", "minio")
+	t.Setenv("TEST_SECRET_KEY", "minio123")
+
+	client, err := newS3Client(t.Context(), s3Options{
+		Endpoint:       "http://minio.minio:9000",
+		ForcePathStyle: aws.Bool(true),
+		Credentials:    credentialsConfig{AccessKeyIDEnv: "TEST_ACCESS_KEY", SecretAccessKeyEnv: "TEST_SECRET_KEY"},
+	})
+	require.NoError(t, err)
+
+	opts := client.Options()
+	assert.Equal(t, customEndpointRegion, opts.Region)
+	assert.Equal(t, "http://minio.minio:9000", aws.ToString(opts.BaseEndpoint))
+	assert.True(t, opts.UsePathStyle)
+}
+
+func TestNewS3ClientRequiresRegion(t *testing.T) {
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+	t.Setenv("AWS_CONFIG_FILE", "/dev/null")
+
+	_, err := newS3Client(t.Context(), s3Options{})
+	require.EqualError(t, err, "region must be set, e.g. with AWS_REGION")
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+
+	gcs "cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/handlers"
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/storage"
+)
+
+const (
+	backendS3         = "s3"
+	backendFilesystem = "filesystem"
+	backendAzure      = "azure"
+	backendGCS        = "gcs"
+)
+
+var supportedBackends = []string{backendS3, backendFilesystem, backendAzure, backendGCS}
+
+type streamConfig struct {
+	Name           string       `yaml:"name"`
+	PrefixTemplate string       `yaml:"prefixTemplate,omitempty"`
+	Format         string       `yaml:"format,omitempty"`
+	Storage        storeOptions `yaml:",inline"`
+}
+
+// storeOptions selects the backend holding a stream's objects. Bucket names the S3 or GCS bucket, or the Azure
+// container. S3 options are inlined for compatibility; Azure and GCS options live in their own sections.
+type storeOptions struct {
+	Backend string       `yaml:"backend,omitempty"`
+	Bucket  string       `yaml:"bucket,omitempty"`
+	Path    string       `yaml:"path,omitempty"`
+	S3      s3Options    `yaml:",inline"`
+	Azure   azureOptions `yaml:"azure,omitempty"`
+	GCS     gcsOptions   `yaml:"gcs,omitempty"`
+}
+
+// storeFactory builds stores, sharing them (and clients) between streams with identical options. It is kept across
+// reloads, so that stores whose options did not change are reused, and closes the ones a reload no longer uses.
+type storeFactory struct {
+	defaults   storeOptions
+	s3Clients  map[s3Options]*s3.Client
+	gcsClients map[gcsOptions]*gcs.Client
+	stores     map[storeOptions]storage.Store
+	// active holds the options of the stores and clients used by the current registry, and building those used by
+	// the registry being built.
+	active, building storeUsage
+}
+
+// storeUsage is a set of store and client options.
+type storeUsage struct {
+	s3     map[s3Options]bool
+	gcs    map[gcsOptions]bool
+	stores map[storeOptions]bool
+}
+
+func newStoreUsage() storeUsage {
+	return storeUsage{s3: map[s3Options]bool{}, gcs: map[gcsOptions]bool{}, stores: map[storeOptions]bool{}}
+}
+
+func newStoreFactory() *storeFactory {
+	return &storeFactory{
+		s3Clients:  map[s3Options]*s3.Client{},
+		gcsClients: map[gcsOptions]*gcs.Client{},
+		stores:     map[storeOptions]storage.Store{},
+		active:     newStoreUsage(),
+		building:   newStoreUsage(),
+	}
+}
+
+// begin starts building the stores of a registry, with defaults filling the options left unset.
+func (f *storeFactory) begin(defaults storeOptions) {
+	f.defaults = defaults
+	f.building = newStoreUsage()
+}
+
+// commit makes the stores built since begin the current ones. It returns a function closing the stores and clients
+// the previous registry used and the new one does not, to call once no request uses the previous registry anymore.
+func (f *storeFactory) commit() func() {
+	f.active = f.building
+	return f.release(f.active)
+}
+
+// discard drops the stores and clients built since begin that the current registry does not use, e.g. after a
+// rejected configuration.
+func (f *storeFactory) discard() {
+	f.building = newStoreUsage()
+	f.release(f.active)()
+}
+
+// release removes the stores and clients not in keep, returning a function that closes them.
+func (f *storeFactory) release(keep storeUsage) func() {
+	var closers []io.Closer
+	for opts, store := range f.stores {
+		if !keep.stores[opts] {
+			delete(f.stores, opts)
+			if closer, ok := store.(io.Closer); ok {
+				closers = append(closers, closer)
+			}
+		}
+	}
+	for opts, client := range f.gcsClients {
+		if !keep.gcs[opts] {
+			delete(f.gcsClients, opts)
+			closers = append(closers, client)
+		}
+	}
+	for opts := range f.s3Clients {
+		// S3 clients hold nothing but idle connections, which their transport closes.
+		if !keep.s3[opts] {
+			delete(f.s3Clients, opts)
+		}
+	}
+	return func() {
+		for _, closer := range closers {
+			if err := closer.Close(); err != nil {
+				slog.Warn("closing unused store", "error", err)
+			}
+		}
+	}
+}
+
+func (f *storeFactory) store(ctx context.Context, opts storeOptions) (storage.Store, error) {
+	opts.Backend = cmp.Or(opts.Backend, f.defaults.Backend, backendS3)
+	if !slices.Contains(supportedBackends, opts.Backend) {
+		return nil, fmt.Errorf("unsupported backend %q, must be one of %v", opts.Backend, supportedBackends)
+	}
+	if opts.Backend != backendFilesystem && opts.Bucket == "" {
+		return nil, fmt.Errorf("bucket must be provided for the %s backend", opts.Backend)
+	}
+	opts = opts.withDefaults(f.defaults)
+	if store, found := f.stores[opts]; found {
+		f.use(opts)
+		return store, nil
+	}
+
+	var store storage.Store
+	switch opts.Backend {
+	case backendS3:
+		client, found := f.s3Clients[opts.S3]
+		if !found {
+			var err error
+			if client, err = newS3Client(ctx, opts.S3); err != nil {
+				return nil, err
+			}
+			f.s3Clients[opts.S3] = client
+		}
+		store = storage.NewS3(client, opts.Bucket)
+	case backendAzure:
+		client, err := newAzureContainerClient(opts.Azure, opts.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		store = storage.NewAzureBlob(client)
+	case backendGCS:
+		client, found := f.gcsClients[opts.GCS]
+		if !found {
+			var err error
+			if client, err = newGCSClient(ctx, opts.GCS); err != nil {
+				return nil, err
+			}
+			f.gcsClients[opts.GCS] = client
+		}
+		store = storage.NewGCS(client, opts.Bucket)
+	case backendFilesystem:
+		if opts.Path == "" {
+			return nil, errors.New("path must be provided for the filesystem backend")
+		}
+		fsStore, err := storage.NewFilesystem(opts.Path)
+		if err != nil {
+			return nil, err
+		}
+		store = fsStore
+	}
+
+	f.stores[opts] = store
+	f.use(opts)
+	return store, nil
+}
+
+// use records that the registry being built uses the store of opts and its client.
+func (f *storeFactory) use(opts storeOptions) {
+	f.building.stores[opts] = true
+	switch opts.Backend {
+	case backendS3:
+		f.building.s3[opts.S3] = true
+	case backendGCS:
+		f.building.gcs[opts.GCS] = true
+	}
+}
+
+// withDefaults keeps only the options of the selected backend, filling them from defaults.
+func (o storeOptions) withDefaults(defaults storeOptions) storeOptions {
+	selected := storeOptions{Backend: o.Backend, Bucket: o.Bucket}
+	switch o.Backend {
+	case backendS3:
+		selected.S3 = o.S3.merge(defaults.S3)
+	case backendFilesystem:
+		selected.Path = o.Path
+	case backendAzure:
+		selected.Azure = o.Azure.merge(defaults.Azure)
+	case backendGCS:
+		selected.GCS = o.GCS.merge(defaults.GCS)
+	}
+	return selected
+}
+
+// newRegistry declares the configured streams, with stores from factory. When the storage section has a bucket or
+// path, the other streams matching the stream patterns are served from it.
+func newRegistry(ctx context.Context, factory *storeFactory, cfg config) (*handlers.Registry, error) {
+	factory.begin(cfg.Storage)
+
+	var fallbackStream *handlers.Stream
+	if cfg.Storage.Bucket != "" || cfg.Storage.Path != "" {
+		store, err := factory.store(ctx, cfg.Storage)
+		if err != nil {
+			return nil, err
+		}
+		fallbackStream = &handlers.Stream{Store: store, Patterns: cfg.StreamPatterns}
+	}
+
+	streams := make([]handlers.Stream, 0, len(cfg.Streams))
+	for _, sc := range cfg.Streams {
+		store, err := factory.store(ctx, sc.Storage)
+		if err != nil {
+			return nil, fmt.Errorf("stream %s: %w", sc.Name, err)
+		}
+
+		streams = append(streams, handlers.Stream{
+			Name:           sc.Name,
+			PrefixTemplate: sc.PrefixTemplate,
+			Format:         sc.Format,
+			Store:          store,
+		})
+	}
+
+	return handlers.NewRegistry(fallbackStream, streams...)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRegistryFilesystem(t *testing.T) {
+	dir := t.TempDir()
+
+	registry, err := newRegistry(t.Context(), newStoreFactory(), config{
+		Storage:        storeOptions{Backend: backendFilesystem, Path: dir},
+		StreamPatterns: []string{"any*"},
+		Streams:        []streamConfig{{Name: "local", Storage: storeOptions{Backend: backendFilesystem, Path: dir}}},
+	})
+	require.NoError(t, err)
+
+	stream, ok := registry.Lookup("anything")
+	require.True(t, ok)
+	_, ok = registry.Lookup("other")
+	require.False(t, ok, "undeclared streams must match a pattern")
+	require.NoError(t, stream.Store.Check(t.Context()))
+	assert.Len(t, registry.Locations(), 1, "streams with identical storage options share a store")
+
+	_, err = newRegistry(t.Context(), newStoreFactory(), config{
+		Streams: []streamConfig{{Name: "broken", Storage: storeOptions{Backend: "ftp"}}},
+	})
+	require.EqualError(t, err, `stream broken: unsupported backend "ftp", must be one of [s3 filesystem azure gcs]`)
+}
+
+func TestNewRegistryCloudBackends(t *testing.T) {
+	t.Setenv("TEST_AZURE_CONNECTION_STRING", "DefaultEndpointsProtocol=http;AccountName=devstoreaccount1;"+
+		"AccountKey=Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw==;"+
+		"BlobEndpoint=http://127.0.0.1:10000/devstoreaccount1;")
+
+	registry, err := newRegistry(t.Context(), newStoreFactory(), config{
+		Storage: storeOptions{GCS: gcsOptions{WithoutAuthentication: aws.Bool(true)}},
+		Streams: []streamConfig{
+			{Name: "aks-logs", Storage: storeOptions{
+				Backend: backendAzure,
+				Bucket:  "logs",
+				Azure:   azureOptions{ConnectionStringEnv: "TEST_AZURE_CONNECTION_STRING"},
+			}},
+			{Name: "gke-logs", Storage: storeOptions{
+				Backend: backendGCS,
+				Bucket:  "mdai-logs",
+				GCS:     gcsOptions{Endpoint: "http://127.0.0.1:4443/storage/v1/"},
+			}},
+		},
+	})
+	require.NoError(t, err)
+
+	aks, ok := registry.Lookup("aks-logs")
+	require.True(t, ok)
+	assert.Equal(t, "azblob://127.0.0.1:10000/devstoreaccount1/logs", aks.Store.Location())
+
+	gke, ok := registry.Lookup("gke-logs")
+	require.True(t, ok)
+	assert.Equal(t, "gs://mdai-logs", gke.Store.Location())
+
+	_, err = newRegistry(t.Context(), newStoreFactory(), config{
+		Streams: []streamConfig{{Name: "broken", Storage: storeOptions{Backend: backendAzure}}},
+	})
+	require.EqualError(t, err, "stream broken: bucket must be provided for the azure backend")
+}
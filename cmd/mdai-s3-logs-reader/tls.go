@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	tlsVersion12 = "1.2"
+	tlsVersion13 = "1.3"
+
+	clientAuthRequire  = "require"
+	clientAuthOptional = "optional"
+
+	// certCheckInterval bounds how often the certificate files are read to notice a rotation, e.g. by cert-manager.
+	certCheckInterval = 10 * time.Second
+)
+
+var tlsVersions = map[string]uint16{tlsVersion12: tls.VersionTLS12, tlsVersion13: tls.VersionTLS13}
+
+// tlsConfig enables HTTPS when a certificate is configured, and mutual TLS when a client CA is.
+type tlsConfig struct {
+	CertFile string `yaml:"certFile,omitempty"`
+	KeyFile  string `yaml:"keyFile,omitempty"`
+	// ClientCAFile holds the CAs client certificates are verified against.
+	ClientCAFile string `yaml:"clientCAFile,omitempty"`
+	// ClientAuth is "require", or "optional" to verify client certificates only when presented, e.g. so that kubelet
+	// probes without a certificate still pass.
+	ClientAuth string `yaml:"clientAuth,omitempty"`
+	MinVersion string `yaml:"minVersion"`
+}
+
+func (c tlsConfig) enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+func (c tlsConfig) validate() error {
+	var errs []error
+	if c.enabled() && (c.CertFile == "" || c.KeyFile == "") {
+		errs = append(errs, errors.New("certFile and keyFile must be provided together"))
+	}
+	if c.ClientCAFile != "" && !c.enabled() {
+		errs = append(errs, errors.New("clientCAFile requires certFile and keyFile"))
+	}
+	if c.ClientAuth != "" && !slices.Contains([]string{clientAuthRequire, clientAuthOptional}, c.ClientAuth) {
+		errs = append(errs, fmt.Errorf("invalid clientAuth %q, must be %s or %s", c.ClientAuth, clientAuthRequire,
+			clientAuthOptional))
+	}
+	if c.ClientAuth != "" && c.ClientCAFile == "" {
+		// Without client CAs, client certificates would not be verified at all.
+		errs = append(errs, errors.New("clientAuth requires clientCAFile"))
+	}
+	if _, ok := tlsVersions[c.MinVersion]; !ok {
+		errs = append(errs, fmt.Errorf("invalid minVersion %q, must be %s or %s", c.MinVersion, tlsVersion12,
+			tlsVersion13))
+	}
+	return errors.Join(errs...)
+}
+
+// certificates serves the certificate and client CAs read from the configured files, reading them again when they
+// change. A rotation that cannot be loaded, e.g. a key written before its certificate, keeps the previous ones.
+type certificates struct {
+	cfg tlsConfig
+	now func() time.Time
+
+	mu        sync.Mutex
+	checked   time.Time
+	files     map[string][]byte
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+func newCertificates(cfg tlsConfig) (*certificates, error) {
+	c := &certificates{cfg: cfg, now: time.Now}
+	files := readFiles(c.paths())
+	if err := c.load(files); err != nil {
+		return nil, err
+	}
+	c.checked = c.now()
+	return c, nil
+}
+
+func (c *certificates) paths() []string {
+	paths := []string{c.cfg.CertFile, c.cfg.KeyFile}
+	if c.cfg.ClientCAFile != "" {
+		paths = append(paths, c.cfg.ClientCAFile)
+	}
+	return paths
+}
+
+func (c *certificates) load(files map[string][]byte) error {
+	for _, path := range c.paths() {
+		if _, ok := files[path]; !ok {
+			return fmt.Errorf("cannot read %s", path)
+		}
+	}
+	cert, err := tls.X509KeyPair(files[c.cfg.CertFile], files[c.cfg.KeyFile])
+	if err != nil {
+		return fmt.Errorf("loading certificate %s: %w", c.cfg.CertFile, err)
+	}
+	var clientCAs *x509.CertPool
+	if c.cfg.ClientCAFile != "" {
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(files[c.cfg.ClientCAFile]) {
+			return fmt.Errorf("loading client CAs: no certificate found in %s", c.cfg.ClientCAFile)
+		}
+	}
+	c.files, c.cert, c.clientCAs = files, &cert, clientCAs
+	return nil
+}
+
+// current returns the certificate and client CAs, reloading them when the files changed since the last check.
+func (c *certificates) current() (*tls.Certificate, *x509.CertPool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now := c.now(); now.Sub(c.checked) >= certCheckInterval {
+		c.checked = now
+		files := readFiles(c.paths())
+		if !sameFiles(files, c.files) {
+			if err := c.load(files); err != nil {
+				slog.Warn("keeping the current certificate", "error", err)
+			} else {
+				slog.Info("reloaded certificate", "cert_file", c.cfg.CertFile, "expires", c.cert.Leaf.NotAfter)
+			}
+		}
+	}
+	return c.cert, c.clientCAs
+}
+
+func sameFiles(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, data := range a {
+		if !bytes.Equal(data, b[path]) {
+			return false
+		}
+	}
+	return true
+}
+
+// serverConfig returns the TLS configuration of the server. Every handshake uses the current certificate and client
+// CAs, so that rotated files are picked up without restarting.
+func (c *certificates) serverConfig() *tls.Config {
+	clientAuth := tls.NoClientCert
+	switch {
+	case c.cfg.ClientCAFile != "" && c.cfg.ClientAuth == clientAuthOptional:
+		clientAuth = tls.VerifyClientCertIfGiven
+	case c.cfg.ClientCAFile != "":
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
+	base := &tls.Config{
+		MinVersion: tlsVersions[c.cfg.MinVersion],
+		ClientAuth: clientAuth,
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	config := base.Clone()
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		cert, clientCAs := c.current()
+		perClient := base.Clone()
+		perClient.Certificates = []tls.Certificate{*cert}
+		perClient.ClientCAs = clientCAs
+		return perClient, nil
+	}
+	return config
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCA issues certificates for the TLS tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns the PEM certificate and key of a leaf certificate.
+func (ca *testCA) issue(t *testing.T, serial int64, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "mdai-s3-logs-reader"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+}
+
+func TestServeTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	cfg := tlsConfig{
+		CertFile:     filepath.Join(dir, "tls.crt"),
+		KeyFile:      filepath.Join(dir, "tls.key"),
+		ClientCAFile: filepath.Join(dir, "ca.crt"),
+		MinVersion:   tlsVersion12,
+	}
+	certPEM, keyPEM := ca.issue(t, 10, x509.ExtKeyUsageServerAuth)
+	writeFile(t, cfg.CertFile, certPEM)
+	writeFile(t, cfg.KeyFile, keyPEM)
+	writeFile(t, cfg.ClientCAFile, ca.pem)
+
+	certs, err := newCertificates(cfg)
+	require.NoError(t, err)
+	now := time.Now()
+	certs.now = func() time.Time { return now }
+
+	srv := &http.Server{
+		ReadHeaderTimeout: time.Second,
+		TLSConfig:         certs.serverConfig(),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}),
+	}
+	listener, err := (&net.ListenConfig{}).Listen(t.Context(), "tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, stop := context.WithCancel(t.Context())
+	served := make(chan error, 1)
+	go func() { served <- serve(ctx, srv, listener, time.Second) }()
+	defer func() {
+		stop()
+		require.NoError(t, <-served)
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	clientCertPEM, clientKeyPEM := ca.issue(t, 20, x509.ExtKeyUsageClientAuth)
+	clientCert, err := tls.X509KeyPair(clientCertPEM, clientKeyPEM)
+	require.NoError(t, err)
+
+	get := func(clientCerts []tls.Certificate) (*x509.Certificate, error) {
+		client := &http.Client{Transport: &http.Transport{ForceAttemptHTTP2: true, TLSClientConfig: &tls.Config{
+			RootCAs:      roots,
+			Certificates: clientCerts,
+			MinVersion:   tls.VersionTLS12,
+		}}}
+		defer client.CloseIdleConnections()
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, "https://"+listener.Addr().String(), http.NoBody)
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+		assert.Equal(t, "HTTP/2.0", resp.Proto)
+		return resp.TLS.PeerCertificates[0], nil
+	}
+
+	served1, err := get([]tls.Certificate{clientCert})
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), served1.SerialNumber.Int64())
+
+	_, err = get(nil)
+	require.Error(t, err, "mTLS requires a client certificate")
+
+	rotatedCert, rotatedKey := ca.issue(t, 11, x509.ExtKeyUsageServerAuth)
+	writeFile(t, cfg.KeyFile, rotatedKey)
+	now = now.Add(certCheckInterval)
+	served2, err := get([]tls.Certificate{clientCert})
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), served2.SerialNumber.Int64(), "a half written rotation keeps the current certificate")
+
+	writeFile(t, cfg.CertFile, rotatedCert)
+	now = now.Add(certCheckInterval)
+	served3, err := get([]tls.Certificate{clientCert})
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), served3.SerialNumber.Int64(), "a rotated certificate is served without restarting")
+}
+
+func TestTLSMinVersion(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	cfg := tlsConfig{CertFile: filepath.Join(dir, "tls.crt"), KeyFile: filepath.Join(dir, "tls.key"), MinVersion: tlsVersion13}
+	certPEM, keyPEM := ca.issue(t, 10, x509.ExtKeyUsageServerAuth)
+	writeFile(t, cfg.CertFile, certPEM)
+	writeFile(t, cfg.KeyFile, keyPEM)
+	certs, err := newCertificates(cfg)
+	require.NoError(t, err)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", certs.serverConfig())
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.(*tls.Conn).Handshake()
+			_ = conn.Close()
+		}
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	dial := func(maxVersion uint16) error {
+		conn, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{
+			RootCAs:    roots,
+			MinVersion: tls.VersionTLS12,
+			MaxVersion: maxVersion,
+		})
+		if err == nil {
+			_ = conn.Close()
+		}
+		return err
+	}
+	require.NoError(t, dial(tls.VersionTLS13))
+	require.Error(t, dial(tls.VersionTLS12), "TLS 1.2 is refused")
+}
+
+func TestNewCertificatesErrors(t *testing.T) {
+	dir := t.TempDir()
+	_, err := newCertificates(tlsConfig{CertFile: filepath.Join(dir, "missing.crt"), KeyFile: filepath.Join(dir, "tls.key")})
+	require.EqualError(t, err, "cannot read "+filepath.Join(dir, "missing.crt"))
+}
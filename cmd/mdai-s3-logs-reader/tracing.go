@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const (
+	defaultServiceName = "mdai-s3-logs-reader"
+	tracesURLPath      = "/v1/traces"
+)
+
+// untracedPaths are polled by Kubernetes and Prometheus and would only add noise to the traces.
+var untracedPaths = []string{"/healthz", "/readyz", "/metrics"}
+
+// tracingConfig configures the export of the reader's own traces over OTLP/HTTP.
+type tracingConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Endpoint is the OTLP/HTTP endpoint, e.g. http://otel-collector:4318; /v1/traces is appended when it has no path.
+	// When empty, the standard OTEL_EXPORTER_OTLP_* environment variables apply.
+	Endpoint    string  `yaml:"endpoint,omitempty"`
+	ServiceName string  `yaml:"serviceName"`
+	SampleRatio float64 `yaml:"sampleRatio"`
+}
+
+func (c tracingConfig) validate() error {
+	var errs []error
+	if c.Endpoint != "" {
+		endpoint, err := url.Parse(c.Endpoint)
+		if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+			errs = append(errs, fmt.Errorf("invalid endpoint %q: must be an absolute http(s) URL", c.Endpoint))
+		}
+	}
+	if c.Enabled && c.ServiceName == "" {
+		errs = append(errs, errors.New("serviceName must be provided"))
+	}
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		errs = append(errs, fmt.Errorf("sampleRatio must be between 0 and 1, got %g", c.SampleRatio))
+	}
+	return errors.Join(errs...)
+}
+
+// setupTracing installs the global tracer provider and the W3C trace context propagator. The returned function flushes
+// the spans that are still buffered.
+func setupTracing(ctx context.Context, cfg tracingConfig) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if !cfg.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var exporterOpts []otlptracehttp.Option
+	if cfg.Endpoint != "" {
+		endpoint, err := url.Parse(cfg.Endpoint)
+		if err != nil {
+			return nil, err
+		}
+		if endpoint.Path == "" || endpoint.Path == "/" {
+			endpoint.Path = tracesURLPath
+		}
+		exporterOpts = append(exporterOpts, otlptracehttp.WithEndpointURL(endpoint.String()))
+	}
+	exporter, err := otlptracehttp.New(ctx, exporterOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create OTLP trace exporter: %w", err)
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(attribute.String("service.name", cfg.ServiceName)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// traceHandler starts a server span per request, continuing the trace of the caller, e.g. Grafana. The router renames
+// the span after the matched route.
+func traceHandler(h http.Handler) http.Handler {
+	return otelhttp.NewHandler(h, "http.server",
+		otelhttp.WithFilter(func(r *http.Request) bool {
+			return !slices.Contains(untracedPaths, r.URL.Path)
+		}),
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method
+		}),
+	)
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// APIKeys authenticates requests with static keys, sent as "Authorization: Bearer <key>" or in X-API-Key.
+type APIKeys struct {
+	keys []apiKey
+}
+
+type apiKey struct {
+	name string
+	hash [sha256.Size]byte
+}
+
+// LoadAPIKeys reads the keys from a secret file with one "<principal>:<key>" pair per line. Blank lines and lines
+// starting with # are ignored.
+func LoadAPIKeys(path string) (*APIKeys, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading API keys: %w", err)
+	}
+	keys, err := ParseAPIKeys(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing API keys %s: %w", path, err)
+	}
+	return keys, nil
+}
+
+func ParseAPIKeys(data []byte) (*APIKeys, error) {
+	a := &APIKeys{}
+	names := map[string]bool{}
+	var errs []error
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, key, ok := strings.Cut(text, ":")
+		name, key = strings.TrimSpace(name), strings.TrimSpace(key)
+		switch {
+		case !ok || name == "" || key == "":
+			errs = append(errs, fmt.Errorf("line %d: must be <principal>:<key>", line))
+		case names[name]:
+			errs = append(errs, fmt.Errorf("line %d: principal %q is declared more than once", line, name))
+		default:
+			names[name] = true
+			a.keys = append(a.keys, apiKey{name: name, hash: sha256.Sum256([]byte(key))})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 && len(a.keys) == 0 {
+		errs = append(errs, errors.New("no keys found"))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Authenticate compares the hash of the key against every known key in constant time, so that neither the key nor
+// the position of its match leak through the response time. Bearer tokens that look like JWTs are left to the JWT
+// authenticator.
+func (a *APIKeys) Authenticate(r *http.Request) (Principal, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		token, ok := bearerToken(r)
+		if !ok || looksLikeJWT(token) {
+			return Principal{}, ErrNoCredentials
+		}
+		key = token
+	}
+
+	hash := sha256.Sum256([]byte(key))
+	match := -1
+	for i, k := range a.keys {
+		if subtle.ConstantTimeCompare(hash[:], k.hash[:]) == 1 {
+			match = i
+		}
+	}
+	if match < 0 {
+		return Principal{}, fmt.Errorf("%w: unknown API key", ErrInvalidCredentials)
+	}
+	return Principal{Name: a.keys[match].name, Method: MethodAPIKey}, nil
+}
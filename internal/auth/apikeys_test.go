@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadAPIKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api-keys")
+	require.NoError(t, os.WriteFile(path, []byte("# Grafana datasource\ngrafana: s3cr3t\n\nci:0ther\n"), 0o600))
+
+	keys, err := LoadAPIKeys(path)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		header  string
+		value   string
+		want    string
+		wantErr error
+	}{
+		{name: "bearer", header: "Authorization", value: "Bearer s3cr3t", want: "grafana"},
+		{name: "api key header", header: APIKeyHeader, value: "0ther", want: "ci"},
+		{name: "unknown key", header: APIKeyHeader, value: "guess", wantErr: ErrInvalidCredentials},
+		{name: "basic auth", header: "Authorization", value: "Basic Z3JhZmFuYTpzM2NyM3Q=", wantErr: ErrNoCredentials},
+		{name: "JWT", header: "Authorization", value: "Bearer a.b.c", wantErr: ErrNoCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/streams", nil)
+			req.Header.Set(tt.header, tt.value)
+			principal, err := keys.Authenticate(req)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, Principal{Name: tt.want, Method: MethodAPIKey}, principal)
+		})
+	}
+}
+
+func TestParseAPIKeysErrors(t *testing.T) {
+	_, err := ParseAPIKeys([]byte("grafana\nci:a\nci:b\n:c\n"))
+	require.EqualError(t, err, "line 1: must be <principal>:<key>\n"+
+		"line 3: principal \"ci\" is declared more than once\n"+
+		"line 4: must be <principal>:<key>")
+
+	_, err = ParseAPIKeys([]byte("# no keys yet\n"))
+	require.EqualError(t, err, "no keys found")
+}
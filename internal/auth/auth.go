@@ -0,0 +1,100 @@
+// Package auth authenticates API requests with static API keys or JWT bearer tokens.
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const (
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+
+	// APIKeyHeader is accepted besides "Authorization: Bearer <key>" for clients that cannot set the latter.
+	APIKeyHeader = "X-API-Key"
+
+	realm = "mdai-s3-logs-reader"
+)
+
+var (
+	// ErrNoCredentials means that the request carries no credentials the authenticator understands.
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidCredentials means that the credentials are unknown, malformed, expired or not signed by a trusted key.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrForbidden means that the credentials are valid but do not grant access to the API.
+	ErrForbidden = errors.New("forbidden")
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	// Name identifies the caller, e.g. the name of its API key or the subject of its token.
+	Name   string
+	Method string
+	// Claims holds the claims of a JWT, for authorization decisions. It is nil for API keys.
+	Claims map[string]any
+}
+
+// Authenticator identifies the caller of a request. It returns an error wrapping ErrNoCredentials,
+// ErrInvalidCredentials or ErrForbidden when the request cannot be authenticated.
+type Authenticator interface {
+	Authenticate(r *http.Request) (Principal, error)
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFrom returns the principal a request was authenticated as.
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
+
+// Chain tries the authenticators in order and returns the first principal found. Authenticators that do not
+// understand the credentials of a request return ErrNoCredentials, so that the next one gets a chance.
+type Chain []Authenticator
+
+func (c Chain) Authenticate(r *http.Request) (Principal, error) {
+	for _, authenticator := range c {
+		principal, err := authenticator.Authenticate(r)
+		if !errors.Is(err, ErrNoCredentials) {
+			return principal, err
+		}
+	}
+	return Principal{}, ErrNoCredentials
+}
+
+// WriteError responds with 401 for missing or invalid credentials and 403 for valid credentials without access. The
+// details of invalid credentials are not disclosed to the client.
+func WriteError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrForbidden):
+		w.Header().Set("WWW-Authenticate", `Bearer realm="`+realm+`", error="insufficient_scope"`)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	case errors.Is(err, ErrNoCredentials):
+		w.Header().Set("WWW-Authenticate", `Bearer realm="`+realm+`"`)
+		http.Error(w, "Unauthorized: credentials must be provided", http.StatusUnauthorized)
+	default:
+		w.Header().Set("WWW-Authenticate", `Bearer realm="`+realm+`", error="invalid_token"`)
+		http.Error(w, "Unauthorized: invalid credentials", http.StatusUnauthorized)
+	}
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// looksLikeJWT tells JWTs, made of three base64url segments, apart from API keys.
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
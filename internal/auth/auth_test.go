@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChain(t *testing.T) {
+	keys, err := ParseAPIKeys([]byte("grafana:s3cr3t\n"))
+	require.NoError(t, err)
+	chain := Chain{keys}
+
+	req := httptest.NewRequest(http.MethodGet, "/streams", nil)
+	_, err = chain.Authenticate(req)
+	require.ErrorIs(t, err, ErrNoCredentials)
+
+	req.Header.Set("Authorization", "Bearer s3cr3t")
+	principal, err := chain.Authenticate(req)
+	require.NoError(t, err)
+	assert.Equal(t, Principal{Name: "grafana", Method: MethodAPIKey}, principal)
+
+	req.Header.Set("Authorization", "Bearer wrong")
+	_, err = chain.Authenticate(req)
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantHeader string
+	}{
+		{"missing", ErrNoCredentials, http.StatusUnauthorized, `Bearer realm="mdai-s3-logs-reader"`},
+		{"invalid", ErrInvalidCredentials, http.StatusUnauthorized, `Bearer realm="mdai-s3-logs-reader", error="invalid_token"`},
+		{"forbidden", ErrForbidden, http.StatusForbidden, `Bearer realm="mdai-s3-logs-reader", error="insufficient_scope"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			WriteError(rec, tt.err)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantHeader, rec.Header().Get("WWW-Authenticate"))
+		})
+	}
+}
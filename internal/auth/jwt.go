@@ -0,0 +1,254 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+const (
+	defaultPrincipalClaim = "sub"
+
+	// keysMaxAge bounds how long the keys of an issuer are used before they are fetched again.
+	keysMaxAge = time.Hour
+	// minKeysRefreshInterval keeps tokens with unknown key IDs from making the reader hammer the issuer.
+	minKeysRefreshInterval = time.Minute
+	keysFetchTimeout       = 10 * time.Second
+	maxKeysResponseSize    = 1 << 20
+
+	clockSkew = jwt.DefaultLeeway
+)
+
+// signatureAlgorithms are the asymmetric algorithms tokens may be signed with. Symmetric ones are not accepted since
+// the keys come from a JWKS.
+var signatureAlgorithms = []jose.SignatureAlgorithm{
+	jose.RS256, jose.RS384, jose.RS512,
+	jose.PS256, jose.PS384, jose.PS512,
+	jose.ES256, jose.ES384, jose.ES512,
+	jose.EdDSA,
+}
+
+type JWTConfig struct {
+	// Issuer is matched against the "iss" claim. Without JWKSFile, the signing keys are fetched from the jwks_uri of
+	// its OpenID configuration.
+	Issuer string `yaml:"issuer,omitempty"`
+	// JWKSFile is a local JSON Web Key Set with the signing keys.
+	JWKSFile string `yaml:"jwksFile,omitempty"`
+	// Audience, when set, must be one of the "aud" claim values.
+	Audience string `yaml:"audience,omitempty"`
+	// RequiredScopes must all be granted by the "scope" or "scp" claim, otherwise requests are forbidden.
+	RequiredScopes []string `yaml:"requiredScopes,omitempty"`
+	// PrincipalClaim names the claim identifying the caller, "sub" by default.
+	PrincipalClaim string `yaml:"principalClaim,omitempty"`
+}
+
+// Enabled reports whether any JWT option is set.
+func (c JWTConfig) Enabled() bool {
+	return c.Issuer != "" || c.JWKSFile != "" || c.Audience != "" || len(c.RequiredScopes) > 0 || c.PrincipalClaim != ""
+}
+
+// JWT authenticates requests with signed bearer tokens.
+type JWT struct {
+	cfg  JWTConfig
+	keys keySource
+	now  func() time.Time
+}
+
+// NewJWT loads the keys of cfg.JWKSFile, if any. The keys of an issuer are fetched with client on first use and
+// refreshed periodically, or when a token is signed with an unknown key.
+func NewJWT(cfg JWTConfig, client *http.Client) (*JWT, error) {
+	if cfg.PrincipalClaim == "" {
+		cfg.PrincipalClaim = defaultPrincipalClaim
+	}
+	a := &JWT{cfg: cfg, now: time.Now}
+	switch {
+	case cfg.JWKSFile != "":
+		set, err := loadJWKS(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		a.keys = staticKeys{set: set}
+	case cfg.Issuer != "":
+		a.keys = &issuerKeys{issuer: cfg.Issuer, client: client, now: time.Now}
+	default:
+		return nil, errors.New("either a JWKS file or an issuer must be provided")
+	}
+	return a, nil
+}
+
+func (a *JWT) Authenticate(r *http.Request) (Principal, error) {
+	raw, ok := bearerToken(r)
+	if !ok || !looksLikeJWT(raw) {
+		return Principal{}, ErrNoCredentials
+	}
+	token, err := jwt.ParseSigned(raw, signatureAlgorithms)
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+
+	var keyID string
+	if len(token.Headers) > 0 {
+		keyID = token.Headers[0].KeyID
+	}
+	set, err := a.keys.keys(r.Context(), keyID)
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+
+	var claims jwt.Claims
+	var all map[string]any
+	if err := token.Claims(set, &claims, &all); err != nil {
+		return Principal{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+	expected := jwt.Expected{Issuer: a.cfg.Issuer, Time: a.now()}
+	if a.cfg.Audience != "" {
+		expected.AnyAudience = jwt.Audience{a.cfg.Audience}
+	}
+	if err := claims.ValidateWithLeeway(expected, clockSkew); err != nil {
+		return Principal{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+	if claims.Expiry == nil {
+		return Principal{}, fmt.Errorf("%w: token has no expiry", ErrInvalidCredentials)
+	}
+
+	name, _ := all[a.cfg.PrincipalClaim].(string)
+	if name == "" {
+		return Principal{}, fmt.Errorf("%w: claim %q is missing", ErrInvalidCredentials, a.cfg.PrincipalClaim)
+	}
+	principal := Principal{Name: name, Method: MethodJWT, Claims: all}
+	granted := scopes(all)
+	for _, scope := range a.cfg.RequiredScopes {
+		if !slices.Contains(granted, scope) {
+			return principal, fmt.Errorf("%w: scope %q is not granted", ErrForbidden, scope)
+		}
+	}
+	return principal, nil
+}
+
+// scopes returns the scopes granted by the space separated "scope" claim of RFC 8693 or the "scp" claim, which some
+// issuers use instead, as a string or a list.
+func scopes(claims map[string]any) []string {
+	var granted []string
+	for _, name := range []string{"scope", "scp"} {
+		switch value := claims[name].(type) {
+		case string:
+			granted = append(granted, strings.Fields(value)...)
+		case []any:
+			for _, v := range value {
+				if s, ok := v.(string); ok {
+					granted = append(granted, s)
+				}
+			}
+		}
+	}
+	return granted
+}
+
+type keySource interface {
+	// keys returns the key set to verify a token signed with keyID.
+	keys(ctx context.Context, keyID string) (*jose.JSONWebKeySet, error)
+}
+
+type staticKeys struct {
+	set *jose.JSONWebKeySet
+}
+
+func (s staticKeys) keys(context.Context, string) (*jose.JSONWebKeySet, error) {
+	return s.set, nil
+}
+
+func loadJWKS(path string) (*jose.JSONWebKeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading JWKS: %w", err)
+	}
+	var set jose.JSONWebKeySet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parsing JWKS %s: %w", path, err)
+	}
+	if len(set.Keys) == 0 {
+		return nil, fmt.Errorf("parsing JWKS %s: no keys found", path)
+	}
+	return &set, nil
+}
+
+// issuerKeys fetches the keys published by an OpenID Connect issuer.
+type issuerKeys struct {
+	issuer string
+	client *http.Client
+	now    func() time.Time
+
+	mu        sync.Mutex
+	set       *jose.JSONWebKeySet
+	fetchedAt time.Time
+}
+
+func (k *issuerKeys) keys(ctx context.Context, keyID string) (*jose.JSONWebKeySet, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	age := k.now().Sub(k.fetchedAt)
+	stale := k.set == nil || age >= keysMaxAge
+	unknown := k.set != nil && keyID != "" && len(k.set.Key(keyID)) == 0 && age >= minKeysRefreshInterval
+	if !stale && !unknown {
+		return k.set, nil
+	}
+
+	set, err := k.fetch(ctx)
+	if err != nil {
+		if k.set != nil && !stale {
+			return k.set, nil
+		}
+		return nil, err
+	}
+	k.set, k.fetchedAt = set, k.now()
+	return set, nil
+}
+
+func (k *issuerKeys) fetch(ctx context.Context) (*jose.JSONWebKeySet, error) {
+	ctx, cancel := context.WithTimeout(ctx, keysFetchTimeout)
+	defer cancel()
+
+	var discovery struct {
+		JWKSURI string `json:"jwks_uri"` //nolint:tagliatelle // defined by OpenID Connect Discovery
+	}
+	discoveryURL := strings.TrimSuffix(k.issuer, "/") + "/.well-known/openid-configuration"
+	if err := k.get(ctx, discoveryURL, &discovery); err != nil {
+		return nil, fmt.Errorf("discovering keys of %s: %w", k.issuer, err)
+	}
+	if discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("discovering keys of %s: no jwks_uri", k.issuer)
+	}
+
+	var set jose.JSONWebKeySet
+	if err := k.get(ctx, discovery.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("fetching keys of %s: %w", k.issuer, err)
+	}
+	return &set, nil
+}
+
+func (k *issuerKeys) get(ctx context.Context, url string, dest any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(http.MaxBytesReader(nil, resp.Body, maxKeysResponseSize)).Decode(dest)
+}
@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testIssuer = "https://issuer.example.com"
+
+type testKey struct {
+	private *ecdsa.PrivateKey
+	id      string
+}
+
+func newTestKey(t *testing.T, id string) testKey {
+	t.Helper()
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return testKey{private: private, id: id}
+}
+
+func (k testKey) jwks() jose.JSONWebKeySet {
+	return jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: &k.private.PublicKey, KeyID: k.id, Algorithm: string(jose.ES256), Use: "sig"}}}
+}
+
+func (k testKey) sign(t *testing.T, claims map[string]any) string {
+	t.Helper()
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: jose.JSONWebKey{Key: k.private, KeyID: k.id}},
+		(&jose.SignerOptions{}).WithType("JWT"))
+	require.NoError(t, err)
+	token, err := jwt.Signed(signer).Claims(claims).Serialize()
+	require.NoError(t, err)
+	return token
+}
+
+func validClaims() map[string]any {
+	return map[string]any{
+		"iss":   testIssuer,
+		"sub":   "grafana",
+		"aud":   "mdai-s3-logs-reader",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": "openid logs:read",
+	}
+}
+
+func writeJWKS(t *testing.T, set jose.JSONWebKeySet) string {
+	t.Helper()
+	data, err := json.Marshal(set)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+func bearerRequest(token string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/streams", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func TestJWTWithJWKSFile(t *testing.T) {
+	key := newTestKey(t, "k1")
+	authenticator, err := NewJWT(JWTConfig{
+		Issuer:         testIssuer,
+		JWKSFile:       writeJWKS(t, key.jwks()),
+		Audience:       "mdai-s3-logs-reader",
+		RequiredScopes: []string{"logs:read"},
+	}, http.DefaultClient)
+	require.NoError(t, err)
+
+	with := func(change func(claims map[string]any)) map[string]any {
+		claims := validClaims()
+		change(claims)
+		return claims
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{name: "valid", token: key.sign(t, validClaims())},
+		{name: "scp list", token: key.sign(t, with(func(c map[string]any) {
+			delete(c, "scope")
+			c["scp"] = []string{"logs:read"}
+		}))},
+		{name: "untrusted key", token: newTestKey(t, "k1").sign(t, validClaims()), wantErr: ErrInvalidCredentials},
+		{name: "expired", token: key.sign(t, with(func(c map[string]any) { c["exp"] = time.Now().Add(-time.Hour).Unix() })), wantErr: ErrInvalidCredentials},
+		{name: "no expiry", token: key.sign(t, with(func(c map[string]any) { delete(c, "exp") })), wantErr: ErrInvalidCredentials},
+		{name: "wrong issuer", token: key.sign(t, with(func(c map[string]any) { c["iss"] = "https://evil.example.com" })), wantErr: ErrInvalidCredentials},
+		{name: "wrong audience", token: key.sign(t, with(func(c map[string]any) { c["aud"] = "other" })), wantErr: ErrInvalidCredentials},
+		{name: "no subject", token: key.sign(t, with(func(c map[string]any) { delete(c, "sub") })), wantErr: ErrInvalidCredentials},
+		{name: "missing scope", token: key.sign(t, with(func(c map[string]any) { c["scope"] = "openid" })), wantErr: ErrForbidden},
+		{name: "malformed", token: "not.a.jwt", wantErr: ErrInvalidCredentials},
+		{name: "API key", token: "s3cr3t", wantErr: ErrNoCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal, err := authenticator.Authenticate(bearerRequest(tt.token))
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "grafana", principal.Name)
+			assert.Equal(t, MethodJWT, principal.Method)
+			assert.Equal(t, testIssuer, principal.Claims["iss"])
+		})
+	}
+}
+
+func TestJWTWithIssuer(t *testing.T) {
+	oldKey, newKey := newTestKey(t, "old"), newTestKey(t, "new")
+	var current atomic.Pointer[jose.JSONWebKeySet]
+	oldSet := oldKey.jwks()
+	current.Store(&oldSet)
+	var fetches atomic.Int32
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"issuer": server.URL, "jwks_uri": server.URL + "/keys"})
+	})
+	mux.HandleFunc("GET /keys", func(w http.ResponseWriter, _ *http.Request) {
+		fetches.Add(1)
+		_ = json.NewEncoder(w).Encode(current.Load())
+	})
+
+	authenticator, err := NewJWT(JWTConfig{Issuer: server.URL}, server.Client())
+	require.NoError(t, err)
+	now := time.Now()
+	authenticator.keys.(*issuerKeys).now = func() time.Time { return now }
+
+	claims := validClaims()
+	claims["iss"] = server.URL
+
+	_, err = authenticator.Authenticate(bearerRequest(oldKey.sign(t, claims)))
+	require.NoError(t, err)
+	_, err = authenticator.Authenticate(bearerRequest(oldKey.sign(t, claims)))
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), fetches.Load(), "keys are cached")
+
+	newSet := newKey.jwks()
+	current.Store(&newSet)
+	_, err = authenticator.Authenticate(bearerRequest(newKey.sign(t, claims)))
+	require.ErrorIs(t, err, ErrInvalidCredentials, "unknown keys are not refetched right away")
+	assert.Equal(t, int32(1), fetches.Load())
+
+	now = now.Add(minKeysRefreshInterval)
+	principal, err := authenticator.Authenticate(bearerRequest(newKey.sign(t, claims)))
+	require.NoError(t, err, "rotated keys are picked up")
+	assert.Equal(t, "grafana", principal.Name)
+	assert.Equal(t, int32(2), fetches.Load())
+}
+
+func TestNewJWTErrors(t *testing.T) {
+	_, err := NewJWT(JWTConfig{}, http.DefaultClient)
+	require.EqualError(t, err, "either a JWKS file or an issuer must be provided")
+
+	_, err = NewJWT(JWTConfig{JWKSFile: writeJWKS(t, jose.JSONWebKeySet{})}, http.DefaultClient)
+	require.ErrorContains(t, err, "no keys found")
+}
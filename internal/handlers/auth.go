@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/auth"
+)
+
+// settingsHandler serves a request with the settings that were current when it arrived.
+type settingsHandler func(w http.ResponseWriter, r *http.Request, s *Settings)
+
+// authenticated serves h with the settings current when the request arrives, once its caller is authenticated. The
+// principal and what the policies grant it are attached to the request context, and the principal is reported to
+// the access log.
+func authenticated(rt *Runtime, h settingsHandler) http.HandlerFunc {
+	return routed(func(w http.ResponseWriter, r *http.Request) {
+		s, release := rt.acquire()
+		defer release()
+		if s.Authenticator != nil {
+			principal, err := s.Authenticator.Authenticate(r)
+			if err != nil {
+				if !errors.Is(err, auth.ErrNoCredentials) {
+					logger(r.Context()).Warn("rejected credentials", "principal", principal.Name, "error", err)
+				}
+				auth.WriteError(w, err)
+				return
+			}
+			recordPrincipal(r.Context(), principal)
+			ctx := auth.WithPrincipal(r.Context(), principal)
+			if len(s.Policies) > 0 {
+				ctx = withAccess(ctx, s.Policies, principal)
+			}
+			r = r.WithContext(ctx)
+		}
+		h(w, r, s)
+	})
+}
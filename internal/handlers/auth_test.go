@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/auth"
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthentication(t *testing.T) {
+	keys, err := auth.ParseAPIKeys([]byte("grafana:s3cr3t\n"))
+	require.NoError(t, err)
+	registry, err := NewRegistry(nil, Stream{Name: "audit", Store: storage.NewFS(fstest.MapFS{}, "memory")})
+	require.NoError(t, err)
+	router := AccessLog(NewRuntimeRouter(NewRuntime(Settings{
+		Registry:      registry,
+		Limits:        DefaultLimits(),
+		Authenticator: auth.Chain{keys},
+	})))
+
+	tests := []struct {
+		name       string
+		path       string
+		apiKey     string
+		wantStatus int
+	}{
+		{name: "NoCredentials", path: "/streams", wantStatus: http.StatusUnauthorized},
+		{name: "InvalidKey", path: "/streams", apiKey: "guess", wantStatus: http.StatusUnauthorized},
+		{name: "ValidKey", path: "/streams", apiKey: "s3cr3t", wantStatus: http.StatusOK},
+		{name: "StatusIsProtected", path: "/status", wantStatus: http.StatusUnauthorized},
+		{name: "ProbesArePublic", path: "/healthz", wantStatus: http.StatusOK},
+		{name: "MetricsArePublic", path: "/metrics", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := captureLogs(t)
+			req := httptest.NewRequest(http.MethodGet, tt.path, http.NoBody)
+			if tt.apiKey != "" {
+				req.Header.Set(auth.APIKeyHeader, tt.apiKey)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, tt.wantStatus, rr.Code)
+
+			if tt.apiKey == "s3cr3t" {
+				lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+				var line map[string]any
+				require.NoError(t, json.Unmarshal(lines[len(lines)-1], &line))
+				assert.Equal(t, "grafana", line["principal"])
+				assert.Equal(t, auth.MethodAPIKey, line["auth"])
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/storage"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Levels used as the "level" label of coalesced calls.
+const (
+	coalescedRequest = "request"
+	coalescedObject  = "object"
+)
+
+var coalescedCalls = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: metricsNamespace,
+	Name:      "coalesced_total",
+	Help:      "Calls that shared the result of an identical call already running, by level (request or object).",
+}, []string{"level"})
+
+var (
+	// rangeFlights shares the records of a stream's hours between identical logs requests, e.g. every viewer of a
+	// dashboard refreshing at the same moment.
+	rangeFlights = newFlightGroup[rangeResult](coalescedRequest)
+	// objectFlights shares the download and parsing of an object between requests whose ranges overlap.
+	objectFlights = newFlightGroup[[]LogRecord](coalescedObject)
+)
+
+// flightGroup runs a function once for the concurrent callers asking for the same key, singleflight style. Results
+// are shared: callers must not modify them.
+//
+// Unlike golang.org/x/sync/singleflight, the call is not bound to the context of the caller that started it: it runs
+// until every caller waiting for it has gone away, so that one client disconnecting does not fail the others.
+type flightGroup[T any] struct {
+	level string
+	// abandoned is called, when set, once the last caller has left a call and before the call is canceled.
+	abandoned func()
+
+	mu      sync.Mutex
+	flights map[string]*flight[T]
+}
+
+type flight[T any] struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int
+
+	val T
+	err error
+}
+
+func newFlightGroup[T any](level string) *flightGroup[T] {
+	return &flightGroup[T]{level: level, flights: map[string]*flight[T]{}}
+}
+
+// do returns the result of fn, joining the call running for key if there is one. fn runs with a context carrying
+// the values of ctx, canceled once no caller waits for the result anymore.
+func (g *flightGroup[T]) do(ctx context.Context, key string, fn func(context.Context) (T, error)) (T, error) {
+	g.mu.Lock()
+	if f, ok := g.flights[key]; ok {
+		f.waiters++
+		g.mu.Unlock()
+		coalescedCalls.WithLabelValues(g.level).Inc()
+		return g.wait(ctx, key, f)
+	}
+	flightCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	f := &flight[T]{done: make(chan struct{}), cancel: cancel, waiters: 1}
+	g.flights[key] = f
+	g.mu.Unlock()
+
+	go func() {
+		defer close(f.done)
+		defer cancel()
+		f.val, f.err = fn(flightCtx)
+		g.forget(key, f)
+	}()
+	return g.wait(ctx, key, f)
+}
+
+func (g *flightGroup[T]) wait(ctx context.Context, key string, f *flight[T]) (T, error) {
+	select {
+	case <-f.done:
+		return f.val, f.err
+	case <-ctx.Done():
+	}
+
+	g.mu.Lock()
+	f.waiters--
+	abandoned := f.waiters == 0
+	if abandoned && g.flights[key] == f {
+		// Later callers start afresh rather than joining a call that is being canceled.
+		delete(g.flights, key)
+	}
+	g.mu.Unlock()
+	if abandoned {
+		if g.abandoned != nil {
+			g.abandoned()
+		}
+		f.cancel()
+	}
+	var zero T
+	return zero, ctx.Err()
+}
+
+func (g *flightGroup[T]) forget(key string, f *flight[T]) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.flights[key] == f {
+		delete(g.flights, key)
+	}
+}
+
+// rangeKey identifies the records of hours of the store, whatever the stream name used to reach it.
+func rangeKey(stream Stream, hours []time.Time) string {
+	key := stream.Store.Location()
+	for _, hour := range hours {
+		key += "\x00" + stream.HourPrefix(hour)
+	}
+	return key
+}
+
+// objectKey identifies a version of an object: an object rewritten in place is fetched again.
+func objectKey(stream Stream, obj storage.Object) string {
+	return strings.Join([]string{
+		stream.Store.Location(),
+		obj.Key,
+		obj.ETag,
+		strconv.FormatInt(obj.Size, 10),
+		strconv.FormatInt(obj.LastModified.UnixNano(), 10),
+	}, "\x00")
+}
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/storage"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingStore holds every Get until release is closed and counts the downloads of each key.
+type blockingStore struct {
+	storage.Store
+
+	started chan string
+	release chan struct{}
+
+	mu   sync.Mutex
+	gets map[string]int
+}
+
+func (s *blockingStore) Get(ctx context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	s.gets[key]++
+	s.mu.Unlock()
+	s.started <- key
+	select {
+	case <-s.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return s.Store.Get(ctx, key)
+}
+
+func TestListLogsHandlerCoalescing(t *testing.T) {
+	data, err := os.ReadFile(logFile1)
+	require.NoError(t, err)
+	store := &blockingStore{
+		Store: storage.NewFS(fstest.MapFS{
+			"audit/2025/01/17/02/a.json": {Data: data},
+			"audit/2025/01/17/03/b.json": {Data: data},
+		}, "memory"),
+		started: make(chan string, 10),
+		release: make(chan struct{}),
+		gets:    map[string]int{},
+	}
+	registry, err := NewRegistry(nil, Stream{Name: "audit", Store: store})
+	require.NoError(t, err)
+	router := NewRouter(registry, DefaultLimits())
+
+	requestsBefore := testutil.ToFloat64(coalescedCalls.WithLabelValues(coalescedRequest))
+	objectsBefore := testutil.ToFloat64(coalescedCalls.WithLabelValues(coalescedObject))
+
+	const (
+		hour2   = "/logs/audit/1737079200000?start=1737079200000&end=1737079200000"
+		hours23 = "/logs/audit/1737079200000?start=1737079200000&end=1737082800000"
+	)
+	var wg sync.WaitGroup
+	responses := make([]*httptest.ResponseRecorder, 3)
+	serve := func(i int, url string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responses[i] = httptest.NewRecorder()
+			router.ServeHTTP(responses[i], httptest.NewRequest(http.MethodGet, url, http.NoBody))
+		}()
+	}
+
+	serve(0, hour2)
+	assert.Equal(t, "audit/2025/01/17/02/a.json", <-store.started)
+	serve(1, hour2)
+	serve(2, hours23)
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(coalescedCalls.WithLabelValues(coalescedRequest)) == requestsBefore+1 &&
+			testutil.ToFloat64(coalescedCalls.WithLabelValues(coalescedObject)) == objectsBefore+1
+	}, time.Second, time.Millisecond, "identical requests and overlapping objects join the running calls")
+	close(store.release)
+	wg.Wait()
+
+	assert.Equal(t, map[string]int{"audit/2025/01/17/02/a.json": 1, "audit/2025/01/17/03/b.json": 1}, store.gets)
+	for _, rr := range responses {
+		assert.Equal(t, http.StatusOK, rr.Code)
+	}
+	assert.JSONEq(t, responses[0].Body.String(), responses[1].Body.String())
+}
+
+func TestListLogsHandlerCoalescedRequestsShareSlot(t *testing.T) {
+	data, err := os.ReadFile(logFile1)
+	require.NoError(t, err)
+	store := &blockingStore{
+		Store:   storage.NewFS(fstest.MapFS{"shared/2025/01/17/02/a.json": {Data: data}}, "memory"),
+		started: make(chan string, 10),
+		release: make(chan struct{}),
+		gets:    map[string]int{},
+	}
+	registry, err := NewRegistry(nil, Stream{Name: "shared", Store: store})
+	require.NoError(t, err)
+	rt := NewRuntime(Settings{Registry: registry, Limits: DefaultLimits(), RateLimits: RateLimits{
+		MaxConcurrentQueries: 1,
+		QueueTimeout:         time.Second,
+	}})
+	router := NewRuntimeRouter(rt)
+
+	requestsBefore := testutil.ToFloat64(coalescedCalls.WithLabelValues(coalescedRequest))
+
+	const url = "/logs/shared/1737079200000?start=1737079200000&end=1737079200000"
+	var wg sync.WaitGroup
+	responses := make([]*httptest.ResponseRecorder, 4)
+	serve := func(i int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responses[i] = httptest.NewRecorder()
+			router.ServeHTTP(responses[i], httptest.NewRequest(http.MethodGet, url, http.NoBody))
+		}()
+	}
+
+	serve(0)
+	assert.Equal(t, "shared/2025/01/17/02/a.json", <-store.started)
+	for i := 1; i < len(responses); i++ {
+		serve(i)
+	}
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(coalescedCalls.WithLabelValues(coalescedRequest)) == requestsBefore+3
+	}, time.Second, time.Millisecond, "identical requests join the running load")
+	close(store.release)
+	wg.Wait()
+
+	for _, rr := range responses {
+		assert.Equal(t, http.StatusOK, rr.Code, "identical requests share the query slot of their load")
+	}
+	assert.Equal(t, 0, rt.limiter.queries.running)
+}
+
+func (g *flightGroup[T]) running(key string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.flights[key] != nil
+}
+
+func TestFlightGroup(t *testing.T) {
+	t.Run("CallersShareOneCall", func(t *testing.T) {
+		g := newFlightGroup[int]("test")
+		release := make(chan struct{})
+		calls := 0
+		var wg sync.WaitGroup
+		results := make([]int, 3)
+		for i := range results {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				results[i], _ = g.do(t.Context(), "key", func(context.Context) (int, error) {
+					calls++
+					<-release
+					return 42, nil
+				})
+			}()
+		}
+		assert.Eventually(t, func() bool {
+			g.mu.Lock()
+			defer g.mu.Unlock()
+			return g.flights["key"] != nil && g.flights["key"].waiters == len(results)
+		}, time.Second, time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		assert.Equal(t, 1, calls)
+		assert.Equal(t, []int{42, 42, 42}, results)
+		assert.Empty(t, g.flights, "finished calls are forgotten")
+	})
+
+	t.Run("CanceledOnceEveryCallerLeft", func(t *testing.T) {
+		g := newFlightGroup[int]("test")
+		canceled := make(chan struct{})
+		fn := func(ctx context.Context) (int, error) {
+			<-ctx.Done()
+			close(canceled)
+			return 0, ctx.Err()
+		}
+
+		first, cancelFirst := context.WithCancel(t.Context())
+		second, cancelSecond := context.WithCancel(t.Context())
+		errs := make(chan error, 2)
+		go func() { _, err := g.do(first, "key", fn); errs <- err }()
+		assert.Eventually(t, func() bool {
+			g.mu.Lock()
+			defer g.mu.Unlock()
+			return g.flights["key"] != nil
+		}, time.Second, time.Millisecond)
+		go func() { _, err := g.do(second, "key", fn); errs <- err }()
+		assert.Eventually(t, func() bool {
+			g.mu.Lock()
+			defer g.mu.Unlock()
+			return g.flights["key"].waiters == 2
+		}, time.Second, time.Millisecond)
+
+		cancelFirst()
+		require.ErrorIs(t, <-errs, context.Canceled)
+		select {
+		case <-canceled:
+			t.Fatal("the call was canceled while a caller still waits for it")
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		cancelSecond()
+		require.ErrorIs(t, <-errs, context.Canceled)
+		<-canceled
+	})
+
+	t.Run("JoinWhileAbandoned", func(t *testing.T) {
+		g := newFlightGroup[int]("test")
+		release := make(chan struct{})
+		fn := func(ctx context.Context) (int, error) {
+			select {
+			case <-release:
+				return 42, nil
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			}
+		}
+
+		// A caller arrives while the last one leaves: it must start a call of its own rather than join the one
+		// being canceled.
+		joined := make(chan error, 1)
+		g.abandoned = func() {
+			go func() {
+				val, err := g.do(t.Context(), "key", fn)
+				if err == nil && val != 42 {
+					err = fmt.Errorf("got %d", val)
+				}
+				joined <- err
+			}()
+			assert.Eventually(t, func() bool {
+				g.mu.Lock()
+				defer g.mu.Unlock()
+				return g.flights["key"] != nil && g.flights["key"].waiters == 1
+			}, time.Second, time.Millisecond)
+		}
+
+		abandoned, cancel := context.WithCancel(t.Context())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_, _ = g.do(abandoned, "key", fn)
+		}()
+		require.Eventually(t, func() bool { return g.running("key") }, time.Second, time.Millisecond)
+		cancel()
+		<-done
+
+		close(release)
+		require.NoError(t, <-joined)
+	})
+}
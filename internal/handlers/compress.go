@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	defaultCompressionLevel   = 5
+	defaultCompressionMinSize = 1024
+
+	encodingGzip = "gzip"
+	encodingZstd = "zstd"
+)
+
+// compressibleTypes are the media types worth compressing; everything the API serves is JSON or text.
+var compressibleTypes = []string{"application/json", "application/x-ndjson", "text/"}
+
+// Compression configures the compression of responses, negotiated with Accept-Encoding.
+type Compression struct {
+	Enabled bool `yaml:"enabled"`
+	// Level ranges from 1 (fastest) to 9 (smallest). zstd maps it onto its own, coarser, levels.
+	Level int `yaml:"level"`
+	// MinSize is the size under which responses are sent uncompressed, as compressing them saves little.
+	MinSize int `yaml:"minSize"`
+}
+
+func DefaultCompression() Compression {
+	return Compression{Enabled: true, Level: defaultCompressionLevel, MinSize: defaultCompressionMinSize}
+}
+
+// encoder is implemented by both gzip.Writer and zstd.Encoder.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// Compress compresses the responses of next with zstd or gzip, whichever the client prefers, zstd winning ties.
+// Responses are buffered up to the minimum size before deciding; flushed responses, e.g. NDJSON streams, are
+// compressed right away and each flush pushes the data compressed so far to the client.
+func Compress(cfg Compression) func(http.Handler) http.Handler {
+	if !cfg.Enabled {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	pools := map[string]*sync.Pool{
+		encodingGzip: {New: func() any {
+			w, _ := gzip.NewWriterLevel(io.Discard, cfg.Level)
+			return w
+		}},
+		encodingZstd: {New: func() any {
+			w, _ := zstd.NewWriter(io.Discard, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(cfg.Level)),
+				zstd.WithEncoderConcurrency(1))
+			return w
+		}},
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			cw := &compressWriter{ResponseWriter: w, encoding: encoding, pool: pools[encoding], minSize: cfg.MinSize}
+			defer cw.close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// negotiateEncoding picks zstd or gzip from an Accept-Encoding header, or "" when the client accepts neither. "*"
+// stands for the codings not listed, and a quality of 0 refuses a coding.
+func negotiateEncoding(acceptEncoding string) string {
+	qualities := map[string]float64{}
+	for part := range strings.SplitSeq(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != encodingZstd && coding != encodingGzip && coding != "*" {
+			continue
+		}
+		quality := 1.0
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				continue
+			}
+			quality = q
+		}
+		qualities[coding] = quality
+	}
+
+	best, bestQuality := "", 0.0
+	// zstd comes first, so that it wins ties.
+	for _, coding := range []string{encodingZstd, encodingGzip} {
+		quality, listed := qualities[coding]
+		if !listed {
+			quality = qualities["*"]
+		}
+		if quality > bestQuality {
+			best, bestQuality = coding, quality
+		}
+	}
+	return best
+}
+
+func compressible(header http.Header) bool {
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	for _, t := range compressibleTypes {
+		if strings.HasPrefix(mediaType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// compressWriter holds the start of a response back until it is large enough to be worth compressing, or flushed.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	pool     *sync.Pool
+	minSize  int
+
+	status  int
+	buf     []byte
+	decided bool
+	enc     encoder
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	switch {
+	case w.decided:
+		w.ResponseWriter.WriteHeader(status)
+	case status < http.StatusOK:
+		// Informational responses are sent as they come.
+		w.ResponseWriter.WriteHeader(status)
+	case w.status == 0:
+		w.status = status
+		if status == http.StatusNoContent || status == http.StatusNotModified {
+			w.start(false)
+		}
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.decided {
+		if w.enc != nil {
+			return w.enc.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= w.minSize {
+		if err := w.start(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// start sends the headers, compressing the response if asked and its type allows, and the data held back so far.
+func (w *compressWriter) start(compress bool) error {
+	w.decided = true
+	header := w.Header()
+	if compress && compressible(header) {
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", w.encoding)
+		// The compressed bytes differ from those the ETag was computed for.
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		w.enc, _ = w.pool.Get().(encoder)
+		w.enc.Reset(w.ResponseWriter)
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// FlushError pushes what was written so far to the client, compressed. http.ResponseController calls it rather than
+// flushing the underlying writer, which would skip the data still in the encoder.
+func (w *compressWriter) FlushError() error {
+	if !w.decided {
+		if err := w.start(true); err != nil {
+			return err
+		}
+	}
+	if w.enc != nil {
+		if err := w.enc.Flush(); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *compressWriter) Flush() {
+	_ = w.FlushError()
+}
+
+// close ends the response once the handler returned: small responses are sent as they are.
+func (w *compressWriter) close() {
+	if !w.decided && (w.status != 0 || len(w.buf) > 0) {
+		_ = w.start(false)
+	}
+	if w.enc != nil {
+		_ = w.enc.Close()
+		w.enc.Reset(io.Discard)
+		w.pool.Put(w.enc)
+		w.enc = nil
+	}
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	cases := []struct {
+		name           string
+		acceptEncoding string
+		expect         string
+	}{
+		{"None", "", ""},
+		{"Identity", "identity", ""},
+		{"Gzip", "gzip, deflate, br", encodingGzip},
+		{"ZstdWinsTies", "gzip, zstd", encodingZstd},
+		{"Quality", "zstd;q=0.5, gzip;q=0.8", encodingGzip},
+		{"Refused", "gzip;q=0", ""},
+		{"ZstdRefused", "zstd;q=0", ""},
+		{"AnyRefused", "*;q=0", ""},
+		{"GzipRefusedZstdAccepted", "gzip;q=0, zstd", encodingZstd},
+		{"AnyButZstd", "zstd;q=0, *", encodingGzip},
+		{"Any", "*", encodingZstd},
+		{"CaseInsensitive", "GZIP", encodingGzip},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expect, negotiateEncoding(tt.acceptEncoding))
+		})
+	}
+}
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat(`{"body":"deployment scaled"}`, 100)
+	handler := Compress(Compression{Enabled: true, Level: 5, MinSize: 1024})(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", `"abc"`)
+			switch r.URL.Path {
+			case "/large":
+				writeJSONResponse(w, large)
+			case "/small":
+				writeJSONResponse(w, "small")
+			case "/binary":
+				w.Header().Set("Content-Type", "application/octet-stream")
+				_, _ = w.Write([]byte(large))
+			case "/not-modified":
+				w.WriteHeader(http.StatusNotModified)
+			}
+		}))
+
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		encodingGzip: func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		encodingZstd: func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) },
+	}
+	for encoding, decode := range decoders {
+		t.Run(encoding, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/large", http.NoBody)
+			req.Header.Set("Accept-Encoding", encoding)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, encoding, rr.Header().Get("Content-Encoding"))
+			assert.Equal(t, "Accept-Encoding", rr.Header().Get("Vary"))
+			assert.Equal(t, `W/"abc"`, rr.Header().Get("ETag"), "compressed responses have a weak ETag")
+			assert.Less(t, rr.Body.Len(), len(large)/10)
+			reader, err := decode(rr.Body)
+			require.NoError(t, err)
+			body, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			assert.JSONEq(t, `"`+strings.ReplaceAll(large, `"`, `\"`)+`"`, string(body))
+		})
+	}
+
+	for _, path := range []string{"/small", "/binary", "/not-modified"} {
+		t.Run("Uncompressed"+path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, path, http.NoBody)
+			req.Header.Set("Accept-Encoding", "gzip")
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			assert.Empty(t, rr.Header().Get("Content-Encoding"))
+			assert.Equal(t, `"abc"`, rr.Header().Get("ETag"))
+		})
+	}
+}
+
+func TestCompressStreaming(t *testing.T) {
+	next := make(chan struct{})
+	server := httptest.NewServer(Compress(DefaultCompression())(http.HandlerFunc(
+		func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			rc := http.NewResponseController(w)
+			_, _ = io.WriteString(w, `{"line":1}`+"\n")
+			_ = rc.Flush()
+			<-next
+			_, _ = io.WriteString(w, `{"line":2}`+"\n")
+		})))
+	defer server.Close()
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, server.URL, http.NoBody)
+	require.NoError(t, err)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, encodingGzip, resp.Header.Get("Content-Encoding"))
+
+	reader, err := gzip.NewReader(resp.Body)
+	require.NoError(t, err)
+	lines := bufio.NewReader(reader)
+	line, err := lines.ReadString('\n')
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"line":1}`, line, "a flushed line reaches the client before the response ends")
+
+	close(next)
+	line, err = lines.ReadString('\n')
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"line":2}`, line)
+}
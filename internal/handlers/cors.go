@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/auth"
+)
+
+// anyOrigin allows requests from every origin in CORS.AllowedOrigins.
+const anyOrigin = "*"
+
+const defaultCORSMaxAge = 10 * time.Minute
+
+// CORS lets browser applications on other origins, e.g. an internal web tool or Grafana's browser-mode Infinity
+// queries, call the API.
+type CORS struct {
+	// AllowedOrigins lists the origins allowed to call the API, e.g. https://grafana.example.com, or "*" for any. CORS
+	// is disabled when empty.
+	AllowedOrigins []string `yaml:"allowedOrigins,omitempty"`
+	AllowedMethods []string `yaml:"allowedMethods"`
+	// AllowedHeaders lists the request headers browsers may send, matched case-insensitively.
+	AllowedHeaders []string `yaml:"allowedHeaders"`
+	// ExposedHeaders lists the response headers browser applications may read.
+	ExposedHeaders []string `yaml:"exposedHeaders"`
+	// AllowCredentials lets browsers send cookies and Authorization headers; it requires explicit origins.
+	AllowCredentials bool `yaml:"allowCredentials"`
+	// MaxAge is how long browsers may cache the answer to a preflight request.
+	MaxAge time.Duration `yaml:"maxAge"`
+}
+
+func DefaultCORS() CORS {
+	return CORS{
+		AllowedMethods: []string{http.MethodGet, http.MethodHead},
+		AllowedHeaders: []string{"Authorization", "Content-Type", auth.APIKeyHeader, RequestIDHeader, "If-None-Match"},
+		ExposedHeaders: []string{"ETag", "Last-Modified", "Retry-After", RequestIDHeader},
+		MaxAge:         defaultCORSMaxAge,
+	}
+}
+
+func (c CORS) Validate() error {
+	var errs []error
+	for _, origin := range c.AllowedOrigins {
+		if origin == anyOrigin {
+			if c.AllowCredentials {
+				errs = append(errs, errors.New(`allowedOrigins: "*" cannot be used with allowCredentials`))
+			}
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+			origin != u.Scheme+"://"+u.Host {
+			errs = append(errs, fmt.Errorf("allowedOrigins: invalid origin %q, must be scheme://host[:port]", origin))
+		}
+	}
+	if len(c.AllowedOrigins) > 0 && len(c.AllowedMethods) == 0 {
+		errs = append(errs, errors.New("allowedMethods: must be provided"))
+	}
+	if c.MaxAge < 0 {
+		errs = append(errs, fmt.Errorf("maxAge: must not be negative, got %s", c.MaxAge))
+	}
+	return errors.Join(errs...)
+}
+
+// AllowCORS answers the preflight requests of the allowed origins and adds the CORS headers to their requests.
+// Preflight requests are answered before authentication, as browsers send them without credentials.
+func AllowCORS(cfg CORS) func(http.Handler) http.Handler {
+	if len(cfg.AllowedOrigins) == 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	anyAllowed := slices.Contains(cfg.AllowedOrigins, anyOrigin)
+	allowedHeaders := make([]string, 0, len(cfg.AllowedHeaders))
+	for _, header := range cfg.AllowedHeaders {
+		allowedHeaders = append(allowedHeaders, http.CanonicalHeaderKey(header))
+	}
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	exposed := strings.Join(cfg.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			header := w.Header()
+			header.Add("Vary", "Origin")
+			if origin == "" || (!anyAllowed && !slices.Contains(cfg.AllowedOrigins, origin)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			allowOrigin := origin
+			if anyAllowed && !cfg.AllowCredentials {
+				allowOrigin = anyOrigin
+			}
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			if !preflight {
+				header.Set("Access-Control-Allow-Origin", allowOrigin)
+				if cfg.AllowCredentials {
+					header.Set("Access-Control-Allow-Credentials", "true")
+				}
+				if exposed != "" {
+					header.Set("Access-Control-Expose-Headers", exposed)
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+			if slices.Contains(cfg.AllowedMethods, r.Header.Get("Access-Control-Request-Method")) &&
+				allowsHeaders(allowedHeaders, r.Header.Get("Access-Control-Request-Headers")) {
+				header.Set("Access-Control-Allow-Origin", allowOrigin)
+				if cfg.AllowCredentials {
+					header.Set("Access-Control-Allow-Credentials", "true")
+				}
+				header.Set("Access-Control-Allow-Methods", methods)
+				if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+					header.Set("Access-Control-Allow-Headers", requested)
+				}
+				header.Set("Access-Control-Max-Age", maxAge)
+			}
+			// A preflight that is not allowed gets no CORS headers, which makes the browser refuse the request.
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// allowsHeaders reports whether every header of an Access-Control-Request-Headers list is allowed.
+func allowsHeaders(allowed []string, requested string) bool {
+	for header := range strings.SplitSeq(requested, ",") {
+		header = strings.TrimSpace(header)
+		if header != "" && !slices.Contains(allowed, http.CanonicalHeaderKey(header)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/auth"
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllowCORS(t *testing.T) {
+	keys, err := auth.ParseAPIKeys([]byte("grafana:secret\n"))
+	require.NoError(t, err)
+	registry, err := NewRegistry(nil, Stream{Name: "audit", Store: storage.NewFS(fstest.MapFS{}, "memory")})
+	require.NoError(t, err)
+	router := NewRuntimeRouter(NewRuntime(Settings{Registry: registry, Limits: DefaultLimits(), Authenticator: keys}))
+
+	explicit := DefaultCORS()
+	explicit.AllowedOrigins = []string{"https://tools.example.com"}
+	explicit.AllowCredentials = true
+	wildcard := DefaultCORS()
+	wildcard.AllowedOrigins = []string{"*"}
+
+	cases := []struct {
+		name          string
+		cors          CORS
+		method        string
+		headers       map[string]string
+		expectCode    int
+		expectHeaders map[string]string
+	}{
+		{
+			name:   "Preflight",
+			cors:   explicit,
+			method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                         "https://tools.example.com",
+				"Access-Control-Request-Method":  "GET",
+				"Access-Control-Request-Headers": "x-api-key",
+			},
+			expectCode: http.StatusNoContent,
+			expectHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://tools.example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Allow-Methods":     "GET, HEAD",
+				"Access-Control-Allow-Headers":     "x-api-key",
+				"Access-Control-Max-Age":           "600",
+			},
+		},
+		{
+			name:   "PreflightHeaderNotAllowed",
+			cors:   explicit,
+			method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                         "https://tools.example.com",
+				"Access-Control-Request-Method":  "GET",
+				"Access-Control-Request-Headers": "x-debug",
+			},
+			expectCode:    http.StatusNoContent,
+			expectHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:          "PreflightMethodNotAllowed",
+			cors:          explicit,
+			method:        http.MethodOptions,
+			headers:       map[string]string{"Origin": "https://tools.example.com", "Access-Control-Request-Method": "DELETE"},
+			expectCode:    http.StatusNoContent,
+			expectHeaders: map[string]string{"Access-Control-Allow-Methods": ""},
+		},
+		{
+			name:       "AuthenticatedRequest",
+			cors:       explicit,
+			method:     http.MethodGet,
+			headers:    map[string]string{"Origin": "https://tools.example.com", auth.APIKeyHeader: "secret"},
+			expectCode: http.StatusOK,
+			expectHeaders: map[string]string{
+				"Access-Control-Allow-Origin":   "https://tools.example.com",
+				"Access-Control-Expose-Headers": "ETag, Last-Modified, Retry-After, X-Request-ID",
+				"Vary":                          "Origin",
+			},
+		},
+		{
+			name:          "CredentialsStillRequired",
+			cors:          explicit,
+			method:        http.MethodGet,
+			headers:       map[string]string{"Origin": "https://tools.example.com"},
+			expectCode:    http.StatusUnauthorized,
+			expectHeaders: map[string]string{"Access-Control-Allow-Origin": "https://tools.example.com"},
+		},
+		{
+			name:          "OtherOrigin",
+			cors:          explicit,
+			method:        http.MethodGet,
+			headers:       map[string]string{"Origin": "https://evil.example.com", auth.APIKeyHeader: "secret"},
+			expectCode:    http.StatusOK,
+			expectHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:          "AnyOrigin",
+			cors:          wildcard,
+			method:        http.MethodGet,
+			headers:       map[string]string{"Origin": "https://grafana.example.com", auth.APIKeyHeader: "secret"},
+			expectCode:    http.StatusOK,
+			expectHeaders: map[string]string{"Access-Control-Allow-Origin": "*", "Access-Control-Allow-Credentials": ""},
+		},
+		{
+			name:          "Disabled",
+			cors:          DefaultCORS(),
+			method:        http.MethodGet,
+			headers:       map[string]string{"Origin": "https://tools.example.com", auth.APIKeyHeader: "secret"},
+			expectCode:    http.StatusOK,
+			expectHeaders: map[string]string{"Access-Control-Allow-Origin": "", "Vary": ""},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/streams", http.NoBody)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			rr := httptest.NewRecorder()
+			AllowCORS(tt.cors)(router).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectCode, rr.Code)
+			for name, value := range tt.expectHeaders {
+				assert.Equal(t, value, rr.Header().Get(name), name)
+			}
+		})
+	}
+}
+
+func TestCORSValidate(t *testing.T) {
+	cors := DefaultCORS()
+	require.NoError(t, cors.Validate(), "disabled")
+
+	cors.AllowedOrigins = []string{"https://grafana.example.com:3000", "http://localhost:8080"}
+	require.NoError(t, cors.Validate())
+
+	cors.AllowedOrigins = []string{"https://grafana.example.com/", "ftp://files"}
+	cors.MaxAge = -1
+	require.EqualError(t, cors.Validate(), `allowedOrigins: invalid origin "https://grafana.example.com/", `+
+		"must be scheme://host[:port]\n"+
+		`allowedOrigins: invalid origin "ftp://files", must be scheme://host[:port]`+"\n"+
+		"maxAge: must not be negative, got -1ns")
+}
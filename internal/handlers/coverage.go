@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+func StreamCoverageHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, registry *Registry, limits Limits) {
+	name := r.PathValue("stream")
+	if err := ValidateStreamName(name); err != nil {
+		http.Error(w, "Invalid stream: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stream, ok := registry.Lookup(name)
+	if !ok {
+		http.Error(w, "Unknown stream: "+name, http.StatusNotFound)
+		return
+	}
+	if _, allowed := authorizeStream(ctx, stream.Name); !allowed {
+		writeForbidden(ctx, w, stream.Name)
+		return
+	}
+
+	startParam := r.URL.Query().Get("start")
+	endParam := r.URL.Query().Get("end")
+	if startParam == "" || endParam == "" {
+		writeJSONResponse(w, apiResponse{{"Error": "Start and end must be provided"}})
+		return
+	}
+
+	startTime, endTime, err := parseTimeRange(startParam, endParam, limits.MaxCoverageRange)
+	if err != nil {
+		writeJSONResponse(w, apiResponse{{"Error": upperFirst(err.Error())}})
+		return
+	}
+
+	release, err := acquireQuery(ctx)
+	if err != nil {
+		rejectQuery(w, r, err)
+		return
+	}
+	defer release()
+
+	extendWriteDeadline(w, limits.CoverageTimeout)
+	timeoutCtx, cancel := context.WithTimeout(ctx, limits.CoverageTimeout)
+	defer cancel()
+
+	coverage, err := LoadCoverage(timeoutCtx, stream, startTime, endTime)
+	if err != nil {
+		logger(ctx).Error("loading coverage", "stream", name, "error", err)
+		http.Error(w, "Unable to load coverage", http.StatusGatewayTimeout)
+		return
+	}
+
+	writeJSONResponse(w, coverage)
+}
+
+// LoadCoverage lists every hourly partition of stream between start and end and reports which of them hold objects.
+// Hours that could not be listed are reported with an error and are neither counted as covered nor as gaps.
+func LoadCoverage(ctx context.Context, stream Stream, start, end time.Time) (StreamCoverage, error) {
+	coverage := StreamCoverage{
+		Stream: stream.Name,
+		Start:  start,
+		End:    end,
+		Gaps:   []CoverageGap{},
+	}
+
+	var gap *CoverageGap
+	closeGap := func() {
+		if gap != nil {
+			coverage.Gaps = append(coverage.Gaps, *gap)
+			gap = nil
+		}
+	}
+
+	for _, hour := range hoursInRange(start, end) {
+		if err := ctxCanceled(ctx); err != nil {
+			return StreamCoverage{}, err
+		}
+
+		hc := HourCoverage{
+			Hour:   hour,
+			Prefix: stream.HourPrefix(hour),
+		}
+
+		objects, err := stream.Store.List(ctx, hc.Prefix)
+		switch {
+		case err != nil:
+			logger(ctx).Warn("listing objects", "stream", stream.Name, "prefix", hc.Prefix, "error", err)
+			hc.Error = err.Error()
+			closeGap()
+		case len(objects) == 0:
+			coverage.MissingHours++
+			if gap == nil {
+				gap = &CoverageGap{Start: hour}
+			}
+			gap.End = hour.Add(time.Hour)
+			gap.Hours++
+		default:
+			hc.Objects = len(objects)
+			for _, obj := range objects {
+				hc.Bytes += obj.Size
+			}
+			coverage.CoveredHours++
+			coverage.TotalObjects += hc.Objects
+			coverage.TotalBytes += hc.Bytes
+			closeGap()
+		}
+
+		coverage.Hours = append(coverage.Hours, hc)
+	}
+	closeGap()
+
+	return coverage, nil
+}
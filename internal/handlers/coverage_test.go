@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamCoverageHandler(t *testing.T) {
+	mockClient := newPartitionedS3Client(t, map[string]int64{
+		"hub-monitor-hub-logs/2025/01/17/02/a.json": 100,
+		"hub-monitor-hub-logs/2025/01/17/02/b.json": 20,
+		"hub-monitor-hub-logs/2025/01/17/05/c.json": 5,
+	})
+
+	// 2025-01-17T02:20:00Z to 2025-01-17T06:20:00Z
+	req := httptest.NewRequest(http.MethodGet, "/streams/hub-monitor-hub-logs/coverage?start=1737080400000&end=1737094800000", http.NoBody)
+	rr := httptest.NewRecorder()
+	NewRouter(newTestRegistry(t, mockClient), DefaultLimits()).ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	var coverage StreamCoverage
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &coverage))
+
+	hour := func(h int) time.Time { return time.Date(2025, 1, 17, h, 0, 0, 0, time.UTC) }
+	assert.Equal(t, "hub-monitor-hub-logs", coverage.Stream)
+	assert.Equal(t, 2, coverage.CoveredHours)
+	assert.Equal(t, 3, coverage.MissingHours)
+	assert.Equal(t, 3, coverage.TotalObjects)
+	assert.Equal(t, int64(125), coverage.TotalBytes)
+	require.Len(t, coverage.Hours, 5)
+	assert.Equal(t, HourCoverage{Hour: hour(2), Prefix: "hub-monitor-hub-logs/2025/01/17/02/", Objects: 2, Bytes: 120}, coverage.Hours[0])
+	assert.Equal(t, []CoverageGap{
+		{Start: hour(3), End: hour(5), Hours: 2},
+		{Start: hour(6), End: hour(7), Hours: 1},
+	}, coverage.Gaps)
+}
+
+func TestStreamCoverageHandlerInvalidRange(t *testing.T) {
+	cases := []struct {
+		name       string
+		requestURL string
+		expect     string
+	}{
+		{"MissingRange", "/streams/hub-monitor-hub-logs/coverage", "Start and end must be provided"},
+		{"TooLong", "/streams/hub-monitor-hub-logs/coverage?start=1737080400000&end=1737771600000", "Time range must be 7 days or less"},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.requestURL, http.NoBody)
+			rr := httptest.NewRecorder()
+			NewRouter(newTestRegistry(t, &mockS3Client{}), DefaultLimits()).ServeHTTP(rr, req)
+
+			var response apiResponse
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+			assert.Equal(t, apiResponse{{"Error": tt.expect}}, response)
+		})
+	}
+}
@@ -2,75 +2,159 @@ package handlers
 
 import (
 	"context"
-	"errors"
+	"encoding/json"
 	"fmt"
-	"io"
-	"log"
 	"maps"
 	"net/http"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/storage"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	collectorlogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
 	"google.golang.org/protobuf/encoding/protojson"
 )
 
-const s3LogsHandlerTimeout = 2 * time.Minute
-
-// https://docs.aws.amazon.com/sdk-for-go/v2/developer-guide/sdk-utilities-s3.html
-
-type S3API interface {
-	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
-	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+func NewRouter(registry *Registry, limits Limits) *http.ServeMux {
+	return NewRuntimeRouter(NewRuntime(Settings{Registry: registry, Limits: limits}))
 }
 
-func NewRouter(s3Client S3API, s3Bucket string) *http.ServeMux {
+// NewRuntimeRouter serves with the current settings of rt, so that they can be swapped without restarting. The API
+// requires authentication when the settings have an authenticator and is rate limited per client; the probes and
+// metrics are neither.
+func NewRuntimeRouter(rt *Runtime) *http.ServeMux {
 	r := http.NewServeMux()
-	r.HandleFunc("GET /logs/{auditPath}/{timestamp}", func(w http.ResponseWriter, r *http.Request) {
-		ListLogsHandler(r.Context(), w, r, s3Client, s3Bucket)
+	r.HandleFunc("GET /logs/{auditPath}/{timestamp}", authenticated(rt, rateLimited(rt, true,
+		func(w http.ResponseWriter, r *http.Request, s *Settings) {
+			ListLogsHandler(withHourCache(r.Context(), rt.hours), w, r, s.Registry, s.Limits)
+		})))
+	r.HandleFunc("GET /streams", authenticated(rt, rateLimited(rt, false,
+		func(w http.ResponseWriter, r *http.Request, s *Settings) {
+			ListStreamsHandler(r.Context(), w, r, s.Registry, s.Limits)
+		})))
+	r.HandleFunc("GET /streams/{stream}/coverage", authenticated(rt, rateLimited(rt, true,
+		func(w http.ResponseWriter, r *http.Request, s *Settings) {
+			StreamCoverageHandler(r.Context(), w, r, s.Registry, s.Limits)
+		})))
+	r.HandleFunc("GET /streams/{stream}/lag", authenticated(rt, rateLimited(rt, true,
+		func(w http.ResponseWriter, r *http.Request, s *Settings) {
+			StreamLagHandler(r.Context(), w, r, s.Registry, s.Limits)
+		})))
+	r.HandleFunc("GET /status", authenticated(rt, func(w http.ResponseWriter, _ *http.Request, _ *Settings) {
+		StatusHandler(w, rt)
+	}))
+	r.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		HealthHandler(w)
 	})
+	r.Handle("GET /readyz", newReadinessChecker(rt))
+	r.Handle("GET /metrics", promhttp.Handler())
 	return r
 }
 
-func ListLogsHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, s3Client S3API, s3Bucket string) {
+func ListLogsHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, registry *Registry, limits Limits) {
+	start := time.Now()
+	// The query waits for a slot inside the shared load, so the deadline cannot be extended once it has one.
+	extendWriteDeadline(w, queueTimeout(ctx)+limits.QueryTimeout)
+	streamLabel, outcome := unknownStreamLabel, outcomeOK
+	defer func() {
+		logsRequestDuration.WithLabelValues(streamLabel, outcome).Observe(time.Since(start).Seconds())
+	}()
+
 	auditPath := r.PathValue("auditPath")
 
-	if auditPath == "" {
-		http.Error(w, "Invalid audit path: must be provided", http.StatusBadRequest)
+	if err := ValidateStreamName(auditPath); err != nil {
+		outcome = outcomeBadRequest
+		http.Error(w, "Invalid audit path: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stream, ok := registry.Lookup(auditPath)
+	if !ok {
+		outcome = outcomeUnknownStream
+		http.Error(w, "Unknown stream: "+auditPath, http.StatusNotFound)
+		return
+	}
+	streamLabel = stream.Name
+
+	filter, allowed := authorizeStream(ctx, stream.Name)
+	if !allowed {
+		outcome = outcomeForbidden
+		writeForbidden(ctx, w, stream.Name)
 		return
 	}
 
 	startParam := r.URL.Query().Get("start")
 	endParam := r.URL.Query().Get("end")
 
-	var prefixes []string
+	var hours []time.Time
 
 	if startParam != "" && endParam != "" {
-		startTime, endTime, err := processTimeRange(startParam, endParam)
+		startTime, endTime, err := processTimeRange(startParam, endParam, limits.MaxLogsRange)
 		if err != nil {
+			outcome = outcomeInvalidRange
 			writeJSONResponse(w, apiResponse{{"Error": upperFirst(err.Error())}})
 			return
 		}
 
 		for t := startTime; !t.After(endTime); t = t.Add(time.Hour) {
-			prefixes = append(prefixes, fmt.Sprintf("%s/%04d/%02d/%02d/%02d/", auditPath, t.Year(), t.Month(), t.Day(), t.Hour()))
+			hours = append(hours, t)
 		}
 	}
 
-	var returnedLogs []LogRecord
-	for _, prefix := range prefixes {
-		timeoutCtx, cancel := context.WithTimeout(ctx, s3LogsHandlerTimeout)
-		logs, err := LoadLogsFromS3(timeoutCtx, s3Client, s3Bucket, prefix)
-		cancel()
+	loaded, err := rangeFlights.do(ctx, rangeKey(stream, hours), func(ctx context.Context) (rangeResult, error) {
+		release, err := acquireQuery(ctx)
 		if err != nil {
-			log.Printf("Error loading logs for prefix %s: %v", prefix, err)
-			continue
+			return rangeResult{}, err
 		}
-		returnedLogs = append(returnedLogs, logs...)
+		defer release()
+		return loadRange(ctx, stream, hours, limits), nil
+	})
+	if rejectQuery(w, r, err) {
+		outcome = outcomeRejected
+		return
+	}
+	if err != nil && ctx.Err() != nil {
+		// The client went away while waiting for a query slot or an identical request.
+		outcome = outcomeCanceled
+		return
+	}
+	if err != nil {
+		outcome = outcomeError
+		logger(ctx).Error("loading logs", "stream", stream.Name, "error", err)
+		http.Error(w, "Unable to load logs", http.StatusInternalServerError)
+		return
+	}
+	if loaded.failed {
+		outcome = outcomeError
+	}
+	returnedLogs := filterRecords(loaded.logs, filter)
+	if len(loaded.missing) > 0 {
+		outcome = outcomeTimeout
+		writeQueryTimeout(ctx, w, stream, hours, loaded.missing, len(returnedLogs))
+		return
+	}
+	recordsReturned.WithLabelValues(stream.Name).Add(float64(len(returnedLogs)))
+	recordResult(ctx, stream.Name, len(returnedLogs))
+	if len(returnedLogs) == 0 && outcome == outcomeOK {
+		outcome = outcomeEmpty
+	}
+
+	if notModified(w, r, validateLogs(ctx, r, stream, hours, loaded)) {
+		outcome = outcomeNotModified
+		return
+	}
+
+	if r.URL.Query().Get("envelope") == "true" {
+		writeJSONResponse(w, LogsEnvelope{
+			Stream:       auditPath,
+			Logs:         returnedLogs,
+			IngestionLag: summarizeIngestionLag(loaded.lags(filter)),
+		})
+		return
 	}
 
 	if len(returnedLogs) == 0 {
@@ -83,94 +167,219 @@ func ListLogsHandler(ctx context.Context, w http.ResponseWriter, r *http.Request
 	writeJSONResponse(w, returnedLogs)
 }
 
-func LoadLogsFromS3(ctx context.Context, client S3API, bucket string, prefix string) ([]LogRecord, error) {
-	var returnedLogs []LogRecord
+// writeQueryTimeout responds with 504 and the hours a logs query could not read before its deadline.
+func writeQueryTimeout(ctx context.Context, w http.ResponseWriter, stream Stream, hours, missing []time.Time, records int) {
+	logger(ctx).Warn("query timed out", "stream", stream.Name, "hours", len(hours), "missing_hours", len(missing))
+	completed := slices.DeleteFunc(slices.Clone(hours), func(hour time.Time) bool {
+		return slices.ContainsFunc(missing, hour.Equal)
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusGatewayTimeout)
+	_ = json.NewEncoder(w).Encode(QueryTimeout{ // nolint:errchkjson
+		Error:          "Query timed out, " + strconv.Itoa(len(missing)) + " of " + strconv.Itoa(len(hours)) + " hours were not read",
+		Stream:         stream.Name,
+		CompletedHours: completed,
+		MissingHours:   missing,
+		Records:        records,
+	})
+}
+
+func LoadLogs(ctx context.Context, store storage.Store, prefix string) ([]LogRecord, error) {
+	result, err := loadLogs(ctx, Stream{Store: store}, prefix, nil)
+	return result.logs, err
+}
+
+// rangeResult holds the records of the hours of a logs request. Failed is set when some hour could not be read, and
+// missing lists the hours left unread when the query timed out.
+type rangeResult struct {
+	loadResult
+
+	failed  bool
+	missing []time.Time
+}
+
+// loadRange reads the records of each hour within the query timeout, giving each hourly prefix its own timeout.
+// Settled hours are served from the hour cache of ctx, if any.
+func loadRange(ctx context.Context, stream Stream, hours []time.Time, limits Limits) rangeResult {
+	ctx, cancelQuery := context.WithTimeout(ctx, limits.QueryTimeout)
+	defer cancelQuery()
+
+	var result rangeResult
+	for _, hour := range hours {
+		if ctx.Err() != nil {
+			result.missing = append(result.missing, hour)
+			continue
+		}
+		prefix := stream.HourPrefix(hour)
+		timeoutCtx, cancel := context.WithTimeout(ctx, limits.PrefixTimeout)
+		loaded, err := loadLogs(timeoutCtx, stream, prefix, settledHourCache(ctx, hour))
+		cancel()
+		if err != nil && ctx.Err() != nil {
+			result.missing = append(result.missing, hour)
+			continue
+		}
+		if err != nil {
+			logger(ctx).Error("loading logs", "stream", stream.Name, "prefix", prefix, "error", err)
+			result.failed = true
+			continue
+		}
+		for _, read := range loaded.read {
+			read.first += len(result.logs)
+			read.end += len(result.logs)
+			result.read = append(result.read, read)
+		}
+		result.logs = append(result.logs, loaded.logs...)
+		result.objects = append(result.objects, loaded.objects...)
+		result.incomplete = result.incomplete || loaded.incomplete
+	}
+	return result
+}
+
+// loadResult holds the records read below a prefix, and where the records of each object read are. Objects are the
+// listed objects; incomplete is set when some of them could not be read.
+type loadResult struct {
+	logs       []LogRecord
+	read       []objectRecords
+	objects    []storage.Object
+	incomplete bool
+}
+
+// objectRecords locates the records of an object in loadResult.logs.
+type objectRecords struct {
+	obj        storage.Object
+	first, end int
+}
+
+// lags returns the ingestion lag of every object read, measured on the records filter accepts so that callers only
+// learn about records they may read. A nil filter keeps every record.
+func (r loadResult) lags(filter recordFilter) []ObjectLag {
+	var lags []ObjectLag
+	for _, read := range r.read {
+		if lag, ok := newObjectLag(read.obj, filterRecords(r.logs[read.first:read.end], filter)); ok {
+			lags = append(lags, lag)
+		}
+	}
+	return lags
+}
+
+// loadLogs reads the records below prefix. With a cache, the records are served from it while the listed objects are
+// unchanged, and cached once every object could be read.
+func loadLogs(ctx context.Context, stream Stream, prefix string, cache *hourCache) (result loadResult, err error) { //nolint:nonamedreturns,lll
+	ctx, span := tracer.Start(ctx, "load prefix", trace.WithAttributes(
+		attribute.String("stream", stream.Name),
+		attribute.String("prefix", prefix),
+		attribute.Bool("cacheable", cache != nil),
+	))
+	defer func() {
+		span.SetAttributes(attribute.Int("records", len(result.logs)))
+		endSpan(span, err)
+	}()
 
 	if err := ctxCanceled(ctx); err != nil {
-		return nil, err
+		return loadResult{}, err
 	}
 
-	listed, err := ListObjects(ctx, client, bucket, prefix)
+	listed, err := listObjects(ctx, stream, prefix)
 	if err != nil {
-		return nil, err
+		return loadResult{}, err
 	}
 
+	if cache != nil {
+		if cached, ok := cache.lookup(stream, prefix, listed); ok {
+			span.SetAttributes(attribute.Bool("cached", true))
+			return cached, nil
+		}
+	}
+
+	result.objects = listed
 	for _, obj := range listed {
 		if err := ctxCanceled(ctx); err != nil {
-			return nil, err
+			return loadResult{}, err
 		}
 
-		data, err := RetrieveObject(ctx, client, bucket, obj.Key)
+		logs, err := fetchObject(ctx, stream, obj)
 		if err != nil {
-			log.Printf("Error downloading %s: %v", obj.Key, err)
+			if err := ctxCanceled(ctx); err != nil {
+				return loadResult{}, err
+			}
+			result.incomplete = true
 			continue
 		}
 
+		first := len(result.logs)
+		result.read = append(result.read, objectRecords{obj: obj, first: first, end: first + len(logs)})
+		result.logs = append(result.logs, logs...)
+	}
+
+	if cache != nil && !result.incomplete {
+		cache.store(stream, prefix, listed, result)
+	}
+	return result, nil
+}
+
+// fetchObject downloads and parses an object, sharing the work with the requests fetching the same object at the
+// same time. Failures are logged once, by the call doing the work.
+func fetchObject(ctx context.Context, stream Stream, obj storage.Object) ([]LogRecord, error) {
+	return objectFlights.do(ctx, objectKey(stream, obj), func(ctx context.Context) ([]LogRecord, error) {
+		data, err := getObject(ctx, stream, obj)
+		if err != nil {
+			logger(ctx).Warn("downloading object", "stream", stream.Name, "key", obj.Key, "error", err)
+			return nil, err
+		}
+
 		if err := ctxCanceled(ctx); err != nil {
 			return nil, err
 		}
 
-		logs, err := ParseLogRecords(data)
+		logs, err := parseObject(ctx, stream, obj, data)
 		if err != nil {
-			log.Printf("Error parsing logs from %s: %v", obj.Key, err)
-			continue
+			logger(ctx).Warn("parsing object", "stream", stream.Name, "key", obj.Key, "error", err)
+			return nil, err
 		}
+		observeIngestionLag(stream, obj, logs)
+		return logs, nil
+	})
+}
 
-		returnedLogs = append(returnedLogs, logs...)
-	}
+func listObjects(ctx context.Context, stream Stream, prefix string) (listed []storage.Object, err error) { //nolint:nonamedreturns
+	ctx, span := tracer.Start(ctx, "list", trace.WithAttributes(
+		attribute.String("location", stream.Store.Location()),
+		attribute.String("prefix", prefix),
+	))
+	start := time.Now()
+	defer func() {
+		observeStorageOperation(stream.Name, "list", start, err)
+		span.SetAttributes(attribute.Int("objects", len(listed)))
+		endSpan(span, err)
+	}()
 
-	return returnedLogs, nil
+	return stream.Store.List(ctx, prefix)
 }
 
-func ListObjects(ctx context.Context, client S3API, bucket string, prefix string) ([]ListedObject, error) {
-	var err error
-	var output *s3.ListObjectsV2Output
-	input := &s3.ListObjectsV2Input{
-		Bucket: aws.String(bucket),
-		Prefix: aws.String(prefix),
-	}
-	var objects []types.Object
-	objectPaginator := s3.NewListObjectsV2Paginator(client, input)
-	for objectPaginator.HasMorePages() {
-		output, err = objectPaginator.NextPage(ctx)
-		if err != nil {
-			var noBucket *types.NoSuchBucket
-			if errors.As(err, &noBucket) {
-				log.Printf("Bucket %s does not exist.\n", bucket)
-				err = noBucket
-			}
-			break
-		}
-		objects = append(objects, output.Contents...)
-	}
-
-	var listed []ListedObject
-	for _, obj := range objects {
-		if obj.Key != nil && obj.LastModified != nil {
-			listed = append(listed, ListedObject{
-				Key:          *obj.Key,
-				LastModified: *obj.LastModified,
-			})
-		}
-	}
+func getObject(ctx context.Context, stream Stream, obj storage.Object) (data []byte, err error) { //nolint:nonamedreturns
+	ctx, span := tracer.Start(ctx, "get", trace.WithAttributes(attribute.String("key", obj.Key)))
+	start := time.Now()
+	defer func() {
+		observeStorageOperation(stream.Name, "get", start, err)
+		storageBytesDownloaded.WithLabelValues(stream.Name).Add(float64(len(data)))
+		span.SetAttributes(attribute.Int("bytes", len(data)))
+		endSpan(span, err)
+	}()
 
-	return listed, err
+	return stream.Store.Get(ctx, obj.Key)
 }
 
-func RetrieveObject(ctx context.Context, client S3API, bucket, key string) ([]byte, error) {
-	resp, err := client.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
-	})
-	if err != nil {
-		return nil, err
-	}
+func parseObject(ctx context.Context, stream Stream, obj storage.Object, data []byte) (logs []LogRecord, err error) { //nolint:nonamedreturns
+	_, span := tracer.Start(ctx, "parse", trace.WithAttributes(attribute.String("key", obj.Key)))
+	start := time.Now()
 	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			log.Printf("error closing response body: %v", err)
-		}
+		parseDuration.WithLabelValues(stream.Name, outcomeOf(err)).Observe(time.Since(start).Seconds())
+		span.SetAttributes(attribute.Int("records", len(logs)))
+		endSpan(span, err)
 	}()
-	return io.ReadAll(resp.Body)
+
+	return ParseLogRecords(data)
 }
 
 // Leaving pagination logic here for now until we decide if we want to implement it
@@ -10,12 +10,15 @@ import (
 	"net/http/httptest"
 	"os"
 	"slices"
+	"strings"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/storage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -45,6 +48,13 @@ func (m *mockS3Client) ListObjectsV2(ctx context.Context, params *s3.ListObjects
 	return m.ListObjectsV2Func(ctx, params, optFns...)
 }
 
+func newTestRegistry(t *testing.T, client storage.S3API) *Registry {
+	t.Helper()
+	registry, err := NewRegistry(&Stream{Store: storage.NewS3(client, bucket), Patterns: []string{"*"}})
+	require.NoError(t, err)
+	return registry
+}
+
 func TestListLogsHandler(t *testing.T) {
 	cases := []struct {
 		name           string
@@ -113,7 +123,7 @@ func TestListLogsHandler(t *testing.T) {
 
 			req := httptest.NewRequest(http.MethodGet, tt.requestURL, http.NoBody)
 			rr := httptest.NewRecorder()
-			mux := NewRouter(mockClient, bucket)
+			mux := NewRouter(newTestRegistry(t, mockClient), DefaultLimits())
 			mux.ServeHTTP(rr, req)
 
 			assert.Equal(t, http.StatusOK, rr.Code, "Expected status 200, got %d", rr.Code)
@@ -135,7 +145,7 @@ func TestListLogsHandler(t *testing.T) {
 	}
 }
 
-func TestLoadLogsFromS3(t *testing.T) {
+func TestLoadLogs(t *testing.T) {
 	testFile1, err := os.ReadFile(logFile1)
 	require.NoError(t, err)
 	testFile2, err := os.ReadFile(logFile2)
@@ -191,7 +201,7 @@ func TestLoadLogsFromS3(t *testing.T) {
 			}
 
 			ctx := t.Context()
-			logs, err := LoadLogsFromS3(ctx, mockClient, bucket, tt.prefix)
+			logs, err := LoadLogs(ctx, storage.NewS3(mockClient, bucket), tt.prefix)
 			require.NoError(t, err)
 			assert.NotEmpty(t, logs, "Expected at least one log record")
 			t.Logf("Success for %s: parsed %d records. First: %+v", tt.name, len(logs), logs[0])
@@ -199,88 +209,6 @@ func TestLoadLogsFromS3(t *testing.T) {
 	}
 }
 
-func TestGetObjectFromS3(t *testing.T) {
-	testFile1, err := os.ReadFile(logFile1)
-	require.NoError(t, err)
-	cases := []struct {
-		name     string
-		bucket   string
-		key      string
-		prefix   string
-		testFile []byte
-	}{
-		{"case1", bucket, key, prefix, testFile1},
-	}
-
-	for _, tt := range cases {
-		t.Run(tt.name, func(t *testing.T) {
-			mockClient := &mockS3Client{
-				GetObjectFunc: func(_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
-					t.Helper()
-					if params.Bucket == nil {
-						t.Fatal("expect bucket to not be nil")
-					}
-					if e, a := bucket, *params.Bucket; e != a {
-						t.Errorf("expect %v, got %v", e, a)
-					}
-					if params.Key == nil {
-						t.Fatal("expect key to not be nil")
-					}
-					if e, a := key, *params.Key; e != a {
-						t.Errorf("expect %v, got %v", e, a)
-					}
-					return &s3.GetObjectOutput{
-						Body: io.NopCloser(bytes.NewReader(testFile1)),
-					}, nil
-				},
-			}
-			ctx := t.Context()
-			_, err := RetrieveObject(ctx, mockClient, tt.bucket, tt.key)
-			require.NoError(t, err)
-			t.Logf("Success! Test %s", tt.name)
-		})
-	}
-}
-
-func TestListObjectsFromS3(t *testing.T) {
-	expectTime := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
-	cases := []struct {
-		name   string
-		bucket string
-		prefix string
-	}{
-		{"case1", bucket, prefix},
-	}
-	for _, tt := range cases {
-		t.Run(tt.name, func(t *testing.T) {
-			mockClient := &mockS3Client{
-				ListObjectsV2Func: func(_ context.Context, params *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
-					require.NotNil(t, params.Bucket, "expect bucket to be set")
-					assert.Equal(t, bucket, *params.Bucket)
-					assert.Equal(t, prefix, *params.Prefix)
-					return &s3.ListObjectsV2Output{
-						Contents: []types.Object{
-							{
-								Key:          aws.String(logFile1),
-								LastModified: aws.Time(expectTime),
-							},
-							{
-								Key:          aws.String(logFile2),
-								LastModified: aws.Time(expectTime),
-							},
-						},
-						Prefix: aws.String(prefix),
-					}, nil
-				},
-			}
-			ctx := t.Context()
-			content, err := ListObjects(ctx, mockClient, tt.bucket, tt.prefix)
-			require.NoError(t, err, "Expected no error from ListObjects")
-			t.Logf("Success! Test %s output: %+v", tt.name, content)
-		})
-	}
-}
-
 func TestParseLogRecords(t *testing.T) {
 	testFile1, err := os.ReadFile(logFile1)
 	require.NoError(t, err)
@@ -311,3 +239,111 @@ func TestParseLogRecords(t *testing.T) {
 		})
 	}
 }
+
+// slowStore delays the download of the objects of the hours in delays, or until the request is canceled.
+type slowStore struct {
+	storage.Store
+
+	delays map[string]time.Duration
+}
+
+func (s *slowStore) Get(ctx context.Context, key string) ([]byte, error) {
+	for prefix, delay := range s.delays {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return s.Store.Get(ctx, key)
+}
+
+func newSlowRegistry(t *testing.T, delays map[string]time.Duration) *Registry {
+	t.Helper()
+	data, err := os.ReadFile(logFile1)
+	require.NoError(t, err)
+	store := &slowStore{
+		Store: storage.NewFS(fstest.MapFS{
+			"audit/2025/01/17/02/a.json": {Data: data},
+			"audit/2025/01/17/03/b.json": {Data: data},
+			"audit/2025/01/17/04/c.json": {Data: data},
+		}, "memory"),
+		delays: delays,
+	}
+	registry, err := NewRegistry(nil, Stream{Name: "audit", Store: store})
+	require.NoError(t, err)
+	return registry
+}
+
+func TestListLogsHandlerQueryTimeout(t *testing.T) {
+	registry := newSlowRegistry(t, map[string]time.Duration{"audit/2025/01/17/03/": time.Minute})
+	limits := DefaultLimits()
+	limits.QueryTimeout = 100 * time.Millisecond
+	limits.PrefixTimeout = 100 * time.Millisecond
+
+	rr := httptest.NewRecorder()
+	NewRouter(registry, limits).ServeHTTP(rr, httptest.NewRequest(http.MethodGet,
+		"/logs/audit/1737079200000?start=1737079200000&end=1737086400000", http.NoBody))
+
+	require.Equal(t, http.StatusGatewayTimeout, rr.Code)
+	assert.Equal(t, "no-store", rr.Header().Get("Cache-Control"))
+	var response QueryTimeout
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	hour := func(h int) time.Time { return time.Date(2025, 1, 17, h, 0, 0, 0, time.UTC) }
+	assert.Equal(t, "Query timed out, 2 of 3 hours were not read", response.Error)
+	assert.Equal(t, "audit", response.Stream)
+	assert.Equal(t, []time.Time{hour(2)}, response.CompletedHours)
+	assert.Equal(t, []time.Time{hour(3), hour(4)}, response.MissingHours)
+	assert.Positive(t, response.Records)
+}
+
+func TestListLogsHandlerExtendsWriteDeadline(t *testing.T) {
+	registry := newSlowRegistry(t, map[string]time.Duration{"audit/2025/01/17/02/": 300 * time.Millisecond})
+	srv := httptest.NewUnstartedServer(NewRouter(registry, DefaultLimits()))
+	srv.Config.WriteTimeout = 100 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet,
+		srv.URL+"/logs/audit/1737079200000?start=1737079200000&end=1737079200000", http.NoBody)
+	require.NoError(t, err)
+	resp, err := srv.Client().Do(req)
+	require.NoError(t, err, "the query outlasting the server's write timeout is still answered")
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	_, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+}
+
+// deadlineRecorder records the write deadlines set through an http.ResponseController.
+type deadlineRecorder struct {
+	*httptest.ResponseRecorder
+
+	deadline time.Time
+}
+
+func (r *deadlineRecorder) SetWriteDeadline(deadline time.Time) error {
+	r.deadline = deadline
+	return nil
+}
+
+func TestListLogsHandlerWriteDeadlineCoversQueue(t *testing.T) {
+	registry := newSlowRegistry(t, nil)
+	limits := DefaultLimits()
+	rt := NewRuntime(Settings{Registry: registry, Limits: limits, RateLimits: RateLimits{
+		MaxConcurrentQueries: 1,
+		QueueTimeout:         time.Minute,
+	}})
+
+	rr := &deadlineRecorder{ResponseRecorder: httptest.NewRecorder()}
+	start := time.Now()
+	NewRuntimeRouter(rt).ServeHTTP(rr, httptest.NewRequest(http.MethodGet,
+		"/logs/audit/1737079200000?start=1737079200000&end=1737079200000", http.NoBody))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.False(t, rr.deadline.Before(start.Add(time.Minute+limits.QueryTimeout+responseWriteMargin)),
+		"a query waiting for its slot for the whole queue timeout still gets its full query timeout")
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	readinessCacheTTL = 5 * time.Second
+	storeCheckTimeout = 5 * time.Second
+
+	statusOK          = "ok"
+	statusUnavailable = "unavailable"
+)
+
+func HealthHandler(w http.ResponseWriter) {
+	writeJSONResponse(w, map[string]string{"status": statusOK})
+}
+
+// readinessChecker checks the stores of the current registry, caching the result for readinessCacheTTL so that
+// frequent probes do not translate into as many storage calls.
+type readinessChecker struct {
+	rt  *Runtime
+	now func() time.Time
+
+	mu       sync.Mutex
+	registry *Registry
+	result   Readiness
+}
+
+func newReadinessChecker(rt *Runtime) *readinessChecker {
+	return &readinessChecker{rt: rt, now: time.Now}
+}
+
+func (c *readinessChecker) check(ctx context.Context) Readiness {
+	settings, release := c.rt.acquire()
+	defer release()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.registry == settings.Registry && c.now().Sub(c.result.CheckedAt) < readinessCacheTTL {
+		return c.result
+	}
+
+	c.result = CheckStores(ctx, settings.Registry)
+	c.result.ConfigVersion = settings.Version
+	c.result.CheckedAt = c.now()
+	c.registry = settings.Registry
+	return c.result
+}
+
+func (c *readinessChecker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	readiness := c.check(r.Context())
+	if readiness.Status == statusOK {
+		writeJSONResponse(w, readiness)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	_ = json.NewEncoder(w).Encode(readiness) // nolint:errchkjson
+}
+
+// CheckStores checks every distinct store of registry concurrently, e.g. with a single-key listing for S3.
+func CheckStores(ctx context.Context, registry *Registry) Readiness {
+	locations := registry.Locations()
+	checks := make([]StoreCheck, len(locations))
+
+	var wg sync.WaitGroup
+	for i, stream := range locations {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, storeCheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := stream.Store.Check(checkCtx)
+			checks[i] = StoreCheck{
+				Location:   stream.Store.Location(),
+				Status:     statusOK,
+				DurationMs: time.Since(start).Milliseconds(),
+			}
+			if err != nil {
+				checks[i].Status = statusUnavailable
+				checks[i].Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+
+	readiness := Readiness{Status: statusOK, CheckedAt: time.Now(), Stores: checks}
+	for _, check := range checks {
+		if check.Status != statusOK {
+			readiness.Status = statusUnavailable
+		}
+	}
+	return readiness
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthHandler(t *testing.T) {
+	rr := httptest.NewRecorder()
+	NewRouter(newTestRegistry(t, &mockS3Client{}), DefaultLimits()).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/healthz", http.NoBody))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, rr.Body.String())
+}
+
+func TestReadinessChecker(t *testing.T) {
+	var calls int
+	var listErr error
+	client := &mockS3Client{
+		ListObjectsV2Func: func(_ context.Context, params *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+			calls++
+			assert.Equal(t, int32(1), *params.MaxKeys)
+			return &s3.ListObjectsV2Output{}, listErr
+		},
+	}
+	store := storage.NewS3(client, bucket)
+	registry, err := NewRegistry(&Stream{Store: store}, Stream{Name: "audit", Store: store})
+	require.NoError(t, err)
+
+	now := time.Date(2025, 1, 17, 2, 0, 0, 0, time.UTC)
+	checker := newReadinessChecker(NewRuntime(Settings{Registry: registry, Version: "v1"}))
+	checker.now = func() time.Time { return now }
+
+	probe := func() (int, Readiness) {
+		rr := httptest.NewRecorder()
+		checker.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", http.NoBody))
+		var readiness Readiness
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &readiness))
+		return rr.Code, readiness
+	}
+
+	code, readiness := probe()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, statusOK, readiness.Status)
+	assert.Equal(t, "v1", readiness.ConfigVersion)
+	require.Len(t, readiness.Stores, 1, "streams sharing a store are checked once")
+	assert.Equal(t, "s3://"+bucket, readiness.Stores[0].Location)
+	assert.Equal(t, 1, calls)
+
+	listErr = errors.New("access denied")
+	now = now.Add(readinessCacheTTL / 2)
+	code, _ = probe()
+	assert.Equal(t, http.StatusOK, code, "the cached result is served")
+	assert.Equal(t, 1, calls)
+
+	now = now.Add(readinessCacheTTL)
+	code, readiness = probe()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, statusUnavailable, readiness.Status)
+	assert.Equal(t, StoreCheck{
+		Location:   "s3://" + bucket,
+		Status:     statusUnavailable,
+		Error:      "access denied",
+		DurationMs: readiness.Stores[0].DurationMs,
+	}, readiness.Stores[0])
+	assert.Equal(t, 2, calls)
+}
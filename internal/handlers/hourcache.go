@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/storage"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	defaultSettleDelay = 15 * time.Minute
+	defaultMaxHours    = 512
+)
+
+// Results used as the "result" label of hour cache lookups.
+const (
+	cacheHit         = "hit"
+	cacheMiss        = "miss"
+	cacheInvalidated = "invalidated"
+)
+
+var (
+	hourCacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "hour_cache_lookups_total",
+		Help:      "Lookups of settled hours in the hour cache, by result (hit, miss or invalidated).",
+	}, []string{"stream", "result"})
+
+	hourCacheEntries = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "hour_cache_entries",
+		Help:      "Hours held in the hour cache.",
+	})
+)
+
+// HourCache keeps the records of past hours, which stop changing once the exporter has flushed them, so that queries
+// only read the current hours from storage. Cached hours are still listed, and read again when their objects changed.
+type HourCache struct {
+	// SettleDelay is how long after its end an hour is considered complete and may be cached.
+	SettleDelay time.Duration `yaml:"settleDelay"`
+	// MaxHours bounds the hours cached, across all streams; the least recently used are evicted first. 0 disables
+	// the cache.
+	MaxHours int `yaml:"maxHours"`
+}
+
+func DefaultHourCache() HourCache {
+	return HourCache{SettleDelay: defaultSettleDelay, MaxHours: defaultMaxHours}
+}
+
+// hourCache holds the cached hours across configuration reloads.
+type hourCache struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	config  HourCache
+	entries map[string]*list.Element
+	// recent orders the entries from the most to the least recently used.
+	recent *list.List
+}
+
+type cachedHour struct {
+	key         string
+	fingerprint [sha256.Size]byte
+	result      loadResult
+}
+
+func newHourCache(config HourCache) *hourCache {
+	c := &hourCache{now: time.Now, entries: map[string]*list.Element{}, recent: list.New()}
+	c.configure(config)
+	return c
+}
+
+// configure applies a new configuration, evicting the hours over the new bound.
+func (c *hourCache) configure(config HourCache) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.config = config
+	c.evict()
+}
+
+// settled reports whether the hour starting at hour is complete and may be cached.
+func (c *hourCache) settled(hour time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.config.MaxHours > 0 && c.complete(hour)
+}
+
+// complete reports whether the hour starting at hour ended more than the settle delay ago, whether or not the cache
+// is enabled. It must be called with c.mu held.
+func (c *hourCache) complete(hour time.Time) bool {
+	return !c.now().Before(hour.Add(time.Hour + c.config.SettleDelay))
+}
+
+// allComplete reports whether every hour is complete.
+func (c *hourCache) allComplete(hours []time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, hour := range hours {
+		if !c.complete(hour) {
+			return false
+		}
+	}
+	return true
+}
+
+// lookup returns the records cached for the prefix, provided its objects are still the listed ones.
+func (c *hourCache) lookup(stream Stream, prefix string, listed []storage.Object) (loadResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[hourKey(stream, prefix)]
+	if !ok {
+		hourCacheLookups.WithLabelValues(stream.Name, cacheMiss).Inc()
+		return loadResult{}, false
+	}
+	entry, _ := elem.Value.(*cachedHour)
+	if entry.fingerprint != fingerprint(listed) {
+		// A late or rewritten object; the hour is read again and replaces the entry.
+		hourCacheLookups.WithLabelValues(stream.Name, cacheInvalidated).Inc()
+		c.remove(elem)
+		return loadResult{}, false
+	}
+	hourCacheLookups.WithLabelValues(stream.Name, cacheHit).Inc()
+	c.recent.MoveToFront(elem)
+	return entry.result, true
+}
+
+// store caches the records read from the listed objects of the prefix.
+func (c *hourCache) store(stream Stream, prefix string, listed []storage.Object, result loadResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.config.MaxHours <= 0 {
+		return
+	}
+	key := hourKey(stream, prefix)
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	c.entries[key] = c.recent.PushFront(&cachedHour{key: key, fingerprint: fingerprint(listed), result: result})
+	c.evict()
+}
+
+// evict drops the least recently used hours over the bound. It must be called with c.mu held.
+func (c *hourCache) evict() {
+	for c.recent.Len() > max(c.config.MaxHours, 0) {
+		c.remove(c.recent.Back())
+	}
+	hourCacheEntries.Set(float64(c.recent.Len()))
+}
+
+// remove drops an entry. It must be called with c.mu held.
+func (c *hourCache) remove(elem *list.Element) {
+	entry, _ := c.recent.Remove(elem).(*cachedHour)
+	delete(c.entries, entry.key)
+	hourCacheEntries.Set(float64(c.recent.Len()))
+}
+
+func hourKey(stream Stream, prefix string) string {
+	return stream.Store.Location() + "\x00" + prefix
+}
+
+// fingerprint summarizes a listing, so that an object added, removed or rewritten below a cached prefix is noticed.
+// Objects without an ETag are identified by their size and modification time.
+func fingerprint(listed []storage.Object) [sha256.Size]byte {
+	objects := slices.SortedFunc(slices.Values(listed), func(a, b storage.Object) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	h := sha256.New()
+	for _, obj := range objects {
+		h.Write([]byte(obj.Key))
+		h.Write([]byte{0})
+		h.Write([]byte(obj.ETag))
+		h.Write([]byte{0})
+		h.Write(binary.BigEndian.AppendUint64(nil, uint64(obj.Size)))                    //nolint:gosec // Only hashed.
+		h.Write(binary.BigEndian.AppendUint64(nil, uint64(obj.LastModified.UnixNano()))) //nolint:gosec // Only hashed.
+	}
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum
+}
+
+type hourCacheKey struct{}
+
+// withHourCache makes the cache available to the logs loaded with ctx.
+func withHourCache(ctx context.Context, cache *hourCache) context.Context {
+	return context.WithValue(ctx, hourCacheKey{}, cache)
+}
+
+func hourCacheFrom(ctx context.Context) *hourCache {
+	cache, _ := ctx.Value(hourCacheKey{}).(*hourCache)
+	return cache
+}
+
+// settledHourCache returns the cache when the hour may be served from it, and nil otherwise.
+func settledHourCache(ctx context.Context, hour time.Time) *hourCache {
+	cache := hourCacheFrom(ctx)
+	if cache == nil || !cache.settled(hour) {
+		return nil
+	}
+	return cache
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/storage"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingStore counts the downloads of each key.
+type countingStore struct {
+	storage.Store
+
+	mu   sync.Mutex
+	gets map[string]int
+}
+
+func (s *countingStore) Get(ctx context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	s.gets[key]++
+	s.mu.Unlock()
+	return s.Store.Get(ctx, key)
+}
+
+func (s *countingStore) takeGets() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	gets := s.gets
+	s.gets = map[string]int{}
+	return gets
+}
+
+func TestHourCache(t *testing.T) {
+	data, err := os.ReadFile(logFile1)
+	require.NoError(t, err)
+	files := fstest.MapFS{
+		"audit/2025/01/17/02/a.json": {Data: data},
+		"audit/2025/01/17/03/b.json": {Data: data},
+	}
+	store := &countingStore{Store: storage.NewFS(files, "memory"), gets: map[string]int{}}
+	registry, err := NewRegistry(nil, Stream{Name: "audit", Store: store})
+	require.NoError(t, err)
+	rt := NewRuntime(Settings{Registry: registry, Limits: DefaultLimits(), HourCache: HourCache{
+		SettleDelay: 15 * time.Minute,
+		MaxHours:    10,
+	}})
+	rt.hours.now = func() time.Time { return time.Date(2025, 1, 17, 3, 20, 0, 0, time.UTC) }
+	router := NewRuntimeRouter(rt)
+
+	records := func() int {
+		req := httptest.NewRequest(http.MethodGet,
+			"/logs/audit/1737079200000?start=1737079200000&end=1737082800000", http.NoBody)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var logs []LogRecord
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &logs))
+		return len(logs)
+	}
+	hits := func() float64 { return testutil.ToFloat64(hourCacheLookups.WithLabelValues("audit", cacheHit)) }
+
+	want := records()
+	assert.Equal(t, map[string]int{"audit/2025/01/17/02/a.json": 1, "audit/2025/01/17/03/b.json": 1}, store.takeGets())
+
+	hitsBefore := hits()
+	assert.Equal(t, want, records())
+	assert.Equal(t, map[string]int{"audit/2025/01/17/03/b.json": 1}, store.takeGets(),
+		"the settled hour is served from the cache, the current one is read again")
+	assert.InDelta(t, hitsBefore+1, hits(), 0)
+
+	files["audit/2025/01/17/02/late.json"] = &fstest.MapFile{Data: data}
+	records()
+	assert.Equal(t, map[string]int{
+		"audit/2025/01/17/02/a.json":    1,
+		"audit/2025/01/17/02/late.json": 1,
+		"audit/2025/01/17/03/b.json":    1,
+	}, store.takeGets(), "an object landing late invalidates the hour")
+
+	rt.Swap(Settings{Registry: registry, Limits: DefaultLimits()})
+	records()
+	assert.Len(t, store.takeGets(), 3, "disabling the cache drops the cached hours")
+}
+
+func TestHourCacheEviction(t *testing.T) {
+	stream := Stream{Name: "audit", Store: storage.NewFS(fstest.MapFS{}, "memory")}
+	cache := newHourCache(HourCache{MaxHours: 2})
+	listed := []storage.Object{{Key: "a.json", ETag: "1"}}
+	result := loadResult{logs: []LogRecord{{Body: "first"}}}
+
+	cache.store(stream, "02/", listed, result)
+	cache.store(stream, "03/", listed, result)
+	_, ok := cache.lookup(stream, "02/", listed)
+	require.True(t, ok)
+	cache.store(stream, "04/", listed, result)
+
+	_, ok = cache.lookup(stream, "03/", listed)
+	assert.False(t, ok, "the least recently used hour is evicted")
+	cached, ok := cache.lookup(stream, "02/", listed)
+	require.True(t, ok)
+	assert.Equal(t, result, cached)
+
+	_, ok = cache.lookup(stream, "02/", []storage.Object{{Key: "a.json", ETag: "2"}})
+	assert.False(t, ok, "a rewritten object invalidates the hour")
+	_, ok = cache.lookup(stream, "02/", listed)
+	assert.False(t, ok, "invalidated hours are dropped")
+}
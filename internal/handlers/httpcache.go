@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/auth"
+)
+
+const (
+	// settledMaxAge is how long clients may reuse a response about hours that no longer change.
+	settledMaxAge = 24 * time.Hour
+	// recentMaxAge is how long clients may reuse a response about hours still being exported, about one dashboard
+	// refresh.
+	recentMaxAge = 30 * time.Second
+)
+
+// validators identify the representation of a logs response, so that clients and proxies can cache it.
+type validators struct {
+	etag         string
+	lastModified time.Time
+	maxAge       time.Duration
+	private      bool
+	// uncacheable is set when some hour or object could not be read: the next response may hold more records.
+	uncacheable bool
+}
+
+// validateLogs returns the validators of the response to a logs request. The ETag is strong: it changes with the
+// objects listed, the query and, as policies may filter the records, the principal and the policies granting it the
+// stream, which a reload may narrow.
+func validateLogs(ctx context.Context, r *http.Request, stream Stream, hours []time.Time, loaded rangeResult) validators {
+	if loaded.failed || loaded.incomplete {
+		return validators{uncacheable: true}
+	}
+
+	principal, authenticated := auth.PrincipalFrom(ctx)
+	sum := fingerprint(loaded.objects)
+	h := sha256.New()
+	for _, part := range []string{stream.Name, r.URL.Path, r.URL.Query().Encode(), principal.Name} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	h.Write(sum[:])
+	// encoding/json sorts map keys, so the same policies always give the same bytes.
+	grants, _ := json.Marshal(streamGrants(ctx, stream.Name)) //nolint:errchkjson
+	h.Write(grants)
+
+	v := validators{
+		etag:    strconv.Quote(hex.EncodeToString(h.Sum(nil)[:16])),
+		maxAge:  recentMaxAge,
+		private: authenticated,
+	}
+	for _, obj := range loaded.objects {
+		if obj.LastModified.After(v.lastModified) {
+			v.lastModified = obj.LastModified
+		}
+	}
+	if cache := hourCacheFrom(ctx); cache != nil && len(hours) > 0 && cache.allComplete(hours) {
+		v.maxAge = settledMaxAge
+	}
+	return v
+}
+
+// notModified sets the caching headers of the response and, when the client already holds the representation,
+// responds with 304 and returns true.
+func notModified(w http.ResponseWriter, r *http.Request, v validators) bool {
+	if v.uncacheable {
+		w.Header().Set("Cache-Control", "no-store")
+		return false
+	}
+
+	scope := "public"
+	if v.private {
+		scope = "private"
+	}
+	w.Header().Set("Cache-Control", scope+", max-age="+strconv.Itoa(int(v.maxAge.Seconds())))
+	w.Header().Set("ETag", v.etag)
+	if !v.lastModified.IsZero() {
+		w.Header().Set("Last-Modified", v.lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if !matchesETag(r.Header.Get("If-None-Match"), v.etag) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// matchesETag reports whether an If-None-Match header lists etag, using the weak comparison RFC 9110 prescribes for
+// If-None-Match.
+func matchesETag(ifNoneMatch, etag string) bool {
+	for candidate := range strings.SplitSeq(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/auth"
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListLogsHandlerCachingHeaders(t *testing.T) {
+	data, err := os.ReadFile(logFile1)
+	require.NoError(t, err)
+	modified := time.Date(2025, 1, 17, 2, 30, 0, 0, time.UTC)
+	files := fstest.MapFS{
+		"audit/2025/01/17/02/a.json": {Data: data, ModTime: modified},
+		"audit/2025/01/17/03/b.json": {Data: data, ModTime: modified.Add(time.Hour)},
+	}
+	registry, err := NewRegistry(nil, Stream{Name: "audit", Store: storage.NewFS(files, "memory")})
+	require.NoError(t, err)
+	rt := NewRuntime(Settings{Registry: registry, Limits: DefaultLimits(), HourCache: DefaultHourCache()})
+	now := time.Date(2025, 1, 17, 3, 30, 0, 0, time.UTC)
+	rt.hours.now = func() time.Time { return now }
+	router := NewRuntimeRouter(rt)
+
+	get := func(url, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, url, http.NoBody)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	const (
+		settled  = "/logs/audit/1737079200000?start=1737079200000&end=1737079200000"
+		touching = "/logs/audit/1737079200000?start=1737079200000&end=1737082800000"
+	)
+
+	rr := get(settled, "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	etag := rr.Header().Get("ETag")
+	assert.Regexp(t, `^"[0-9a-f]{32}"$`, etag)
+	assert.Equal(t, "public, max-age=86400", rr.Header().Get("Cache-Control"))
+	assert.Equal(t, "Fri, 17 Jan 2025 02:30:00 GMT", rr.Header().Get("Last-Modified"))
+
+	rr = get(settled, etag)
+	assert.Equal(t, http.StatusNotModified, rr.Code)
+	assert.Empty(t, rr.Body.String())
+	assert.Equal(t, etag, rr.Header().Get("ETag"))
+	assert.Equal(t, http.StatusNotModified, get(settled, `"other", W/`+etag).Code, "weak comparison")
+
+	assert.NotEqual(t, etag, get(settled+"&envelope=true", "").Header().Get("ETag"), "the query is part of the ETag")
+
+	rr = get(touching, "")
+	assert.Equal(t, "public, max-age=30", rr.Header().Get("Cache-Control"), "hours still exported are short lived")
+	assert.Equal(t, "Fri, 17 Jan 2025 03:30:00 GMT", rr.Header().Get("Last-Modified"))
+
+	files["audit/2025/01/17/02/late.json"] = &fstest.MapFile{Data: data, ModTime: modified}
+	rr = get(settled, etag)
+	assert.Equal(t, http.StatusOK, rr.Code, "an object landing late changes the ETag")
+	assert.NotEqual(t, etag, rr.Header().Get("ETag"))
+
+	files["audit/2025/01/17/02/broken.json"] = &fstest.MapFile{Data: []byte("{not json"), ModTime: modified}
+	rr = get(settled, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "no-store", rr.Header().Get("Cache-Control"), "responses missing objects are not cached")
+	assert.Empty(t, rr.Header().Get("ETag"))
+}
+
+func TestValidateLogsPolicies(t *testing.T) {
+	stream := Stream{Name: "audit"}
+	req := httptest.NewRequest(http.MethodGet, "/logs/audit/1737079200000", http.NoBody)
+	loaded := rangeResult{loadResult: loadResult{objects: []storage.Object{{Key: "audit/2025/01/17/02/a.json"}}}}
+	alice := auth.Principal{Name: "alice"}
+	policy := func(hubs ...string) Policy {
+		return Policy{Principals: []string{"alice"}, Streams: []string{"audit"}, Records: map[string][]string{
+			"hubName":   hubs,
+			"namespace": {"mdai"},
+		}}
+	}
+	etag := func(policies ...Policy) string {
+		return validateLogs(withAccess(t.Context(), policies, alice), req, stream, nil, loaded).etag
+	}
+
+	wide := etag(policy("hub-a", "hub-b"))
+	assert.Equal(t, wide, etag(policy("hub-a", "hub-b")))
+	assert.NotEqual(t, wide, etag(policy("hub-a")), "narrowed policies change the ETag")
+	assert.Equal(t, wide, etag(policy("hub-a", "hub-b"), Policy{Principals: []string{"bob"}, Streams: []string{"audit"}}),
+		"policies of other principals do not")
+}
+
+func TestMatchesETag(t *testing.T) {
+	cases := []struct {
+		name        string
+		ifNoneMatch string
+		expect      bool
+	}{
+		{"Empty", "", false},
+		{"Same", `"abc"`, true},
+		{"Weak", `W/"abc"`, true},
+		{"List", `"xyz", "abc"`, true},
+		{"Any", "*", true},
+		{"Other", `"xyz"`, false},
+		{"Unquoted", "abc", false},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expect, matchesETag(tt.ifNoneMatch, `"abc"`))
+		})
+	}
+}
@@ -3,8 +3,19 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"time"
 )
 
+// responseWriteMargin is left to write a response after the work it reports on timed out.
+const responseWriteMargin = 30 * time.Second
+
+// extendWriteDeadline pushes the write deadline of the connection, set by the server's WriteTimeout when the request
+// was read, past the time the handler may take, so that long queries are answered rather than cut off.
+func extendWriteDeadline(w http.ResponseWriter, timeout time.Duration) {
+	// Writers that do not support deadlines, e.g. in tests, have none to extend.
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout + responseWriteMargin))
+}
+
 func writeJSONResponse(w http.ResponseWriter, response any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/storage"
+)
+
+func StreamLagHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, registry *Registry, limits Limits) {
+	name := r.PathValue("stream")
+	if err := ValidateStreamName(name); err != nil {
+		http.Error(w, "Invalid stream: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stream, ok := registry.Lookup(name)
+	if !ok {
+		http.Error(w, "Unknown stream: "+name, http.StatusNotFound)
+		return
+	}
+	filter, allowed := authorizeStream(ctx, stream.Name)
+	if !allowed {
+		writeForbidden(ctx, w, stream.Name)
+		return
+	}
+
+	release, err := acquireQuery(ctx)
+	if err != nil {
+		rejectQuery(w, r, err)
+		return
+	}
+	defer release()
+
+	extendWriteDeadline(w, limits.PrefixTimeout)
+	timeoutCtx, cancel := context.WithTimeout(ctx, limits.PrefixTimeout)
+	defer cancel()
+
+	lastHour, err := boundaryHour(timeoutCtx, stream, slices.Max)
+	if err != nil {
+		logger(ctx).Error("finding the most recent hour", "stream", name, "error", err)
+		http.Error(w, "Unable to load ingestion lag", http.StatusBadGateway)
+		return
+	}
+	if lastHour.IsZero() {
+		writeJSONResponse(w, apiResponse{{"Response": "No data found for this stream"}})
+		return
+	}
+
+	result, err := loadLogs(timeoutCtx, stream, stream.HourPrefix(lastHour), nil)
+	if err != nil {
+		logger(ctx).Error("loading logs", "stream", name, "prefix", stream.HourPrefix(lastHour), "error", err)
+		http.Error(w, "Unable to load ingestion lag", http.StatusBadGateway)
+		return
+	}
+
+	lags := result.lags(filter)
+	summary := summarizeIngestionLag(lags)
+	streamLag := StreamLag{
+		Stream:       name,
+		Hour:         lastHour,
+		IngestionLag: summary,
+		Objects:      lags,
+	}
+	if !summary.NewestRecord.IsZero() {
+		streamLag.NewestRecordAgeSeconds = time.Since(summary.NewestRecord).Seconds()
+	}
+	writeJSONResponse(w, streamLag)
+}
+
+// newObjectLag measures how long after its newest record an object landed in the bucket.
+func newObjectLag(obj storage.Object, logs []LogRecord) (ObjectLag, bool) {
+	var newest time.Time
+	for _, rec := range logs {
+		ts, err := time.Parse(time.RFC3339, rec.Timestamp)
+		if err == nil && ts.After(newest) {
+			newest = ts
+		}
+	}
+	if newest.IsZero() || obj.LastModified.IsZero() {
+		return ObjectLag{}, false
+	}
+
+	return ObjectLag{
+		Key:          obj.Key,
+		LastModified: obj.LastModified,
+		NewestRecord: newest,
+		LagSeconds:   obj.LastModified.Sub(newest).Seconds(),
+	}, true
+}
+
+func summarizeIngestionLag(lags []ObjectLag) IngestionLag {
+	summary := IngestionLag{Objects: len(lags)}
+	if len(lags) == 0 {
+		return summary
+	}
+
+	summary.MinSeconds = lags[0].LagSeconds
+	summary.MaxSeconds = lags[0].LagSeconds
+	var total float64
+	for _, lag := range lags {
+		summary.MinSeconds = min(summary.MinSeconds, lag.LagSeconds)
+		summary.MaxSeconds = max(summary.MaxSeconds, lag.LagSeconds)
+		total += lag.LagSeconds
+		if lag.NewestRecord.After(summary.NewestRecord) {
+			summary.NewestRecord = lag.NewestRecord
+		}
+		if lag.LastModified.After(summary.NewestObject) {
+			summary.NewestObject = lag.LastModified
+		}
+	}
+	summary.AvgSeconds = total / float64(len(lags))
+
+	return summary
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/auth"
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newestHubLogRecord is the newest record timestamp in logFile1.
+var newestHubLogRecord = time.Date(2025, 5, 16, 21, 6, 41, 0, time.UTC)
+
+func TestNewObjectLag(t *testing.T) {
+	obj := storage.Object{Key: key, LastModified: time.Date(2025, 1, 17, 2, 5, 0, 0, time.UTC)}
+
+	lag, ok := newObjectLag(obj, []LogRecord{
+		{Timestamp: "2025-01-17T02:00:00Z"},
+		{Timestamp: "2025-01-17T02:04:30Z"},
+		{Timestamp: "not-a-timestamp"},
+	})
+	require.True(t, ok)
+	assert.Equal(t, ObjectLag{
+		Key:          key,
+		LastModified: obj.LastModified,
+		NewestRecord: time.Date(2025, 1, 17, 2, 4, 30, 0, time.UTC),
+		LagSeconds:   30,
+	}, lag)
+
+	_, ok = newObjectLag(obj, []LogRecord{{Timestamp: ""}})
+	assert.False(t, ok)
+}
+
+func TestSummarizeIngestionLag(t *testing.T) {
+	newest := time.Date(2025, 1, 17, 2, 59, 0, 0, time.UTC)
+	summary := summarizeIngestionLag([]ObjectLag{
+		{LastModified: newest.Add(10 * time.Second), NewestRecord: newest, LagSeconds: 10},
+		{LastModified: newest.Add(-time.Minute), NewestRecord: newest.Add(-90 * time.Second), LagSeconds: 30},
+	})
+
+	assert.Equal(t, IngestionLag{
+		Objects:      2,
+		MinSeconds:   10,
+		MaxSeconds:   30,
+		AvgSeconds:   20,
+		NewestRecord: newest,
+		NewestObject: newest.Add(10 * time.Second),
+	}, summary)
+	assert.Equal(t, IngestionLag{}, summarizeIngestionLag(nil))
+}
+
+func TestStreamLagHandler(t *testing.T) {
+	testFile, err := os.ReadFile(logFile1)
+	require.NoError(t, err)
+
+	objectKey := "hub-monitor-hub-logs/2025/05/16/21/a.json"
+	mockClient := newPartitionedS3Client(t, map[string]int64{
+		"hub-monitor-hub-logs/2025/05/16/20/old.json": 1,
+		objectKey: int64(len(testFile)),
+	})
+	mockClient.GetObjectFunc = func(_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+		assert.Equal(t, objectKey, aws.ToString(params.Key))
+		return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(testFile))}, nil
+	}
+
+	router := NewRouter(newTestRegistry(t, mockClient), DefaultLimits())
+	observedBefore := histogramCount(t, ingestionLagSeconds, "hub-monitor-hub-logs")
+	var rr *httptest.ResponseRecorder
+	for range 2 {
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/streams/hub-monitor-hub-logs/lag", http.NoBody))
+		require.Equal(t, http.StatusOK, rr.Code)
+	}
+	assert.Equal(t, observedBefore+1, histogramCount(t, ingestionLagSeconds, "hub-monitor-hub-logs"),
+		"an object polled again is observed once")
+
+	var streamLag StreamLag
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &streamLag))
+	assert.Equal(t, time.Date(2025, 5, 16, 21, 0, 0, 0, time.UTC), streamLag.Hour)
+	assert.Equal(t, 1, streamLag.IngestionLag.Objects)
+	assert.Equal(t, newestHubLogRecord, streamLag.IngestionLag.NewestRecord)
+	require.Len(t, streamLag.Objects, 1)
+	assert.Equal(t, objectKey, streamLag.Objects[0].Key)
+	assert.Positive(t, streamLag.NewestRecordAgeSeconds)
+}
+
+func TestListLogsHandlerEnvelope(t *testing.T) {
+	testFile, err := os.ReadFile(logFile1)
+	require.NoError(t, err)
+	lastModified := newestHubLogRecord.Add(time.Minute)
+
+	mockClient := &mockS3Client{
+		ListObjectsV2Func: func(_ context.Context, _ *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+			return &s3.ListObjectsV2Output{
+				Contents: []types.Object{{Key: aws.String(logFile1), LastModified: aws.Time(lastModified)}},
+			}, nil
+		},
+		GetObjectFunc: func(_ context.Context, _ *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+			return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(testFile))}, nil
+		},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/logs/hub-monitor-hub-logs/files?start=1747429200000&end=1747429260000&envelope=true", http.NoBody)
+	rr := httptest.NewRecorder()
+	NewRouter(newTestRegistry(t, mockClient), DefaultLimits()).ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	var envelope LogsEnvelope
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &envelope))
+	assert.Equal(t, "hub-monitor-hub-logs", envelope.Stream)
+	assert.NotEmpty(t, envelope.Logs)
+	assert.Equal(t, IngestionLag{
+		Objects:      1,
+		MinSeconds:   60,
+		MaxSeconds:   60,
+		AvgSeconds:   60,
+		NewestRecord: newestHubLogRecord,
+		NewestObject: lastModified,
+	}, envelope.IngestionLag)
+}
+
+// hubLogObject returns an OTLP JSON object holding one record of hub at ts.
+func hubLogObject(hub string, ts time.Time) []byte {
+	return fmt.Appendf(nil, `{"resourceLogs":[{"resource":{},"scopeLogs":[{"logRecords":[{"timeUnixNano":"%d",`+
+		`"body":{"stringValue":"reconciled"},"attributes":[{"key":"hub_name","value":{"stringValue":%q}}]}]}]}]}`,
+		ts.UnixNano(), hub)
+}
+
+func TestStreamLagHandlerRecordPolicies(t *testing.T) {
+	hubA, hubB := newestHubLogRecord, newestHubLogRecord.Add(10*time.Minute)
+	lastModified := hubB.Add(time.Minute)
+	store := storage.NewFS(fstest.MapFS{
+		"audit/2025/05/16/21/hub-a.json": {Data: hubLogObject("hub-a", hubA), ModTime: lastModified},
+		"audit/2025/05/16/21/hub-b.json": {Data: hubLogObject("hub-b", hubB), ModTime: lastModified},
+	}, "memory")
+	registry, err := NewRegistry(nil, Stream{Name: "audit", Store: store})
+	require.NoError(t, err)
+	keys, err := auth.ParseAPIKeys([]byte("platform:p\nteam-a:a\n"))
+	require.NoError(t, err)
+	router := NewRuntimeRouter(NewRuntime(Settings{
+		Registry:      registry,
+		Limits:        DefaultLimits(),
+		Authenticator: auth.Chain{keys},
+		Policies: Policies{
+			{Principals: []string{"platform"}, Streams: []string{"*"}},
+			{Principals: []string{"team-a"}, Streams: []string{"audit"}, Records: map[string][]string{"hubName": {"hub-a"}}},
+		},
+	}))
+
+	lag := func(key string) StreamLag {
+		req := httptest.NewRequest(http.MethodGet, "/streams/audit/lag", http.NoBody)
+		req.Header.Set(auth.APIKeyHeader, key)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var streamLag StreamLag
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &streamLag))
+		return streamLag
+	}
+
+	unrestricted := lag("p")
+	assert.Equal(t, 2, unrestricted.IngestionLag.Objects)
+	assert.Equal(t, hubB, unrestricted.IngestionLag.NewestRecord)
+
+	restricted := lag("a")
+	assert.Equal(t, 1, restricted.IngestionLag.Objects, "objects without readable records are left out")
+	assert.Equal(t, hubA, restricted.IngestionLag.NewestRecord)
+	require.Len(t, restricted.Objects, 1)
+	assert.Equal(t, "audit/2025/05/16/21/hub-a.json", restricted.Objects[0].Key)
+}
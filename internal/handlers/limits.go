@@ -0,0 +1,39 @@
+package handlers
+
+import "time"
+
+const (
+	defaultMaxLogsRange     = 4 * time.Hour
+	defaultMaxCoverageRange = 7 * 24 * time.Hour
+	defaultPrefixTimeout    = 2 * time.Minute
+	defaultQueryTimeout     = 5 * time.Minute
+	defaultStreamsTimeout   = 30 * time.Second
+	defaultCoverageTimeout  = time.Minute
+)
+
+// Limits bounds the work a single request may cause against the stores.
+type Limits struct {
+	// MaxLogsRange is the longest time range accepted by the logs endpoint.
+	MaxLogsRange time.Duration `yaml:"maxLogsRange"`
+	// MaxCoverageRange is the longest time range accepted by the coverage endpoint.
+	MaxCoverageRange time.Duration `yaml:"maxCoverageRange"`
+	// PrefixTimeout bounds listing and reading the objects of one hourly partition.
+	PrefixTimeout time.Duration `yaml:"prefixTimeout"`
+	// QueryTimeout bounds a whole logs query. The hours not read by then are reported with 504.
+	QueryTimeout time.Duration `yaml:"queryTimeout"`
+	// StreamsTimeout bounds listing the streams and their metadata.
+	StreamsTimeout time.Duration `yaml:"streamsTimeout"`
+	// CoverageTimeout bounds a coverage report.
+	CoverageTimeout time.Duration `yaml:"coverageTimeout"`
+}
+
+func DefaultLimits() Limits {
+	return Limits{
+		MaxLogsRange:     defaultMaxLogsRange,
+		MaxCoverageRange: defaultMaxCoverageRange,
+		PrefixTimeout:    defaultPrefixTimeout,
+		QueryTimeout:     defaultQueryTimeout,
+		StreamsTimeout:   defaultStreamsTimeout,
+		CoverageTimeout:  defaultCoverageTimeout,
+	}
+}
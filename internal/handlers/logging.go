@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/auth"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+
+	// maxRequestIDLength bounds the request IDs accepted from clients, which end up in every log line.
+	maxRequestIDLength = 128
+)
+
+// quietPaths are polled by Kubernetes and Prometheus, so their access log lines are only written at debug level.
+var quietPaths = []string{"/healthz", "/readyz", "/metrics"}
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	requestStatsKey
+)
+
+// requestStats collects what the access log reports besides the HTTP status.
+type requestStats struct {
+	mu        sync.Mutex
+	principal auth.Principal
+	stream    string
+	records   int
+}
+
+// logger returns the default logger, annotated with the ID of the request ctx belongs to.
+func logger(ctx context.Context) *slog.Logger {
+	if id, ok := ctx.Value(requestIDKey).(string); ok {
+		return slog.Default().With("request_id", id)
+	}
+	return slog.Default()
+}
+
+// recordResult reports the stream and the number of records served to the access log.
+func recordResult(ctx context.Context, stream string, records int) {
+	if stats, ok := ctx.Value(requestStatsKey).(*requestStats); ok {
+		stats.mu.Lock()
+		defer stats.mu.Unlock()
+		stats.stream = stream
+		stats.records = records
+	}
+}
+
+// recordPrincipal reports the authenticated caller to the access log.
+func recordPrincipal(ctx context.Context, principal auth.Principal) {
+	if stats, ok := ctx.Value(requestStatsKey).(*requestStats); ok {
+		stats.mu.Lock()
+		defer stats.mu.Unlock()
+		stats.principal = principal
+	}
+}
+
+// AccessLog tags every request with the ID taken from X-Request-ID, or a generated one, echoes it in the response and
+// writes one log line per request with its status, duration and the records returned.
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		stats := &requestStats{}
+		ctx := context.WithValue(r.Context(), requestIDKey, id)
+		ctx = context.WithValue(ctx, requestStatsKey, stats)
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		level := slog.LevelInfo
+		switch {
+		case recorder.status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case slices.Contains(quietPaths, r.URL.Path):
+			level = slog.LevelDebug
+		}
+
+		stats.mu.Lock()
+		attrs := []slog.Attr{
+			slog.String("request_id", id),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", recorder.status),
+			slog.Int64("duration_ms", time.Since(start).Milliseconds()),
+			slog.Int64("bytes", recorder.bytes),
+		}
+		if stats.principal.Name != "" {
+			attrs = append(attrs, slog.String("principal", stats.principal.Name), slog.String("auth", stats.principal.Method))
+		}
+		if stats.stream != "" {
+			attrs = append(attrs, slog.String("stream", stats.stream), slog.Int("records", stats.records))
+		}
+		stats.mu.Unlock()
+		if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+			attrs = append(attrs, slog.String("trace_id", spanContext.TraceID().String()))
+		}
+		slog.LogAttrs(ctx, level, "request", attrs...)
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	var id [16]byte
+	_, _ = rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// statusRecorder captures the status and size of a response. Unwrap lets http.ResponseController reach the
+// underlying writer, e.g. to flush.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
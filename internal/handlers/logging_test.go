@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureLogs routes the default logger to a JSON buffer for the duration of the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+func TestAccessLog(t *testing.T) {
+	tests := []struct {
+		name      string
+		requestID string
+		handler   http.HandlerFunc
+		wantLine  map[string]any
+	}{
+		{
+			name:      "RequestIDFromClient",
+			requestID: "grafana-1234",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				logger(r.Context()).Warn("downloading object", "key", "a.json")
+				recordResult(r.Context(), "audit", 42)
+				writeJSONResponse(w, []LogRecord{})
+			},
+			wantLine: map[string]any{
+				"level": "INFO", "msg": "request", "request_id": "grafana-1234", "method": "GET", "path": "/logs/audit/files",
+				"status": float64(200), "stream": "audit", "records": float64(42),
+			},
+		},
+		{
+			name:      "InvalidRequestIDIsReplaced",
+			requestID: "has spaces\n",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				http.Error(w, "Unable to load coverage", http.StatusGatewayTimeout)
+			},
+			wantLine: map[string]any{"level": "ERROR", "msg": "request", "status": float64(504)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := captureLogs(t)
+
+			req := httptest.NewRequest(http.MethodGet, "/logs/audit/files", http.NoBody)
+			req.Header.Set(RequestIDHeader, tt.requestID)
+			rr := httptest.NewRecorder()
+			AccessLog(tt.handler).ServeHTTP(rr, req)
+
+			requestID := rr.Header().Get(RequestIDHeader)
+			require.True(t, validRequestID(requestID))
+
+			lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+			var lastLine map[string]any
+			require.NoError(t, json.Unmarshal(lines[len(lines)-1], &lastLine))
+			for key, value := range tt.wantLine {
+				assert.Equal(t, value, lastLine[key], key)
+			}
+			assert.Equal(t, requestID, lastLine["request_id"])
+			assert.Contains(t, lastLine, "duration_ms")
+
+			for _, line := range lines[:len(lines)-1] {
+				var entry map[string]any
+				require.NoError(t, json.Unmarshal(line, &entry))
+				assert.Equal(t, requestID, entry["request_id"], "handler logs carry the request ID")
+			}
+		})
+	}
+}
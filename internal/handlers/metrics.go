@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/storage"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const metricsNamespace = "mdai_s3_logs_reader"
+
+// Outcomes used as the "outcome" label.
+const (
+	outcomeOK            = "ok"
+	outcomeEmpty         = "empty"
+	outcomeError         = "error"
+	outcomeCanceled      = "canceled"
+	outcomeInvalidRange  = "invalid_range"
+	outcomeUnknownStream = "unknown_stream"
+	outcomeBadRequest    = "bad_request"
+	outcomeForbidden     = "forbidden"
+	outcomeNotModified   = "not_modified"
+	outcomeTimeout       = "timeout"
+	outcomeRejected      = "rejected"
+)
+
+// unknownStreamLabel replaces stream names that are not served, which are client input of unbounded cardinality.
+const unknownStreamLabel = "unknown"
+
+var (
+	ingestionLagSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "ingestion_lag_seconds",
+		Help:      "Delay between the newest record of an object and the object's LastModified time, once per object.",
+		Buckets:   []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600, 7200},
+	}, []string{"stream"})
+
+	logsRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "logs_request_duration_seconds",
+		Help:      "Duration of logs requests.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"stream", "outcome"})
+
+	storageOperationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "storage_operation_duration_seconds",
+		Help:      "Duration of storage calls made to serve logs, by operation (list or get).",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"stream", "operation", "outcome"})
+
+	storageBytesDownloaded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "storage_bytes_downloaded_total",
+		Help:      "Bytes of objects downloaded from storage.",
+	}, []string{"stream"})
+
+	parseDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "parse_duration_seconds",
+		Help:      "Duration of parsing one object; the count by outcome gives the objects parsed and the parse failures.",
+		Buckets:   []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5},
+	}, []string{"stream", "outcome"})
+
+	requestsRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "requests_rejected_total",
+		Help:      "Requests rejected with 429, by reason (rate_limited, queue_full or queue_timeout).",
+	}, []string{"reason"})
+
+	queriesRunning = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "queries_running",
+		Help:      "Logs, coverage and lag queries currently running.",
+	})
+
+	queriesQueued = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "queries_queued",
+		Help:      "Queries waiting for a slot because maxConcurrentQueries are running.",
+	})
+
+	recordsReturned = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "records_returned_total",
+		Help:      "Log records returned by the logs endpoint, after de-duplication.",
+	}, []string{"stream"})
+)
+
+// maxObservedObjects bounds the objects remembered to observe the ingestion lag of each object once.
+const maxObservedObjects = 16384
+
+// observedLags remembers the most recent objects whose ingestion lag was observed, so that objects read again by
+// later requests, e.g. every refresh of a dashboard showing the current hour, are not counted again.
+var observedLags = newObservedSet(maxObservedObjects)
+
+// observedSet is a set of keys bounded to the most recently added ones.
+type observedSet struct {
+	mu    sync.Mutex
+	keys  map[string]struct{}
+	order []string
+	next  int
+}
+
+func newObservedSet(size int) *observedSet {
+	return &observedSet{keys: make(map[string]struct{}, size), order: make([]string, size)}
+}
+
+// add reports whether key was not in the set, adding it in place of the oldest key when the set is full.
+func (s *observedSet) add(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, found := s.keys[key]; found {
+		return false
+	}
+	delete(s.keys, s.order[s.next])
+	s.order[s.next] = key
+	s.next = (s.next + 1) % len(s.order)
+	s.keys[key] = struct{}{}
+	return true
+}
+
+// observeIngestionLag observes the ingestion lag of an object the first time it is read.
+func observeIngestionLag(stream Stream, obj storage.Object, logs []LogRecord) {
+	lag, ok := newObjectLag(obj, logs)
+	if !ok || !observedLags.add(objectKey(stream, obj)) {
+		return
+	}
+	// Clock skew between the exporter and the bucket can make the lag slightly negative.
+	ingestionLagSeconds.WithLabelValues(stream.Name).Observe(max(lag.LagSeconds, 0))
+}
+
+func observeStorageOperation(stream, operation string, start time.Time, err error) {
+	storageOperationDuration.WithLabelValues(stream, operation, outcomeOf(err)).Observe(time.Since(start).Seconds())
+}
+
+func outcomeOf(err error) string {
+	switch {
+	case err == nil:
+		return outcomeOK
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return outcomeCanceled
+	default:
+		return outcomeError
+	}
+}
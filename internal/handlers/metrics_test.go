@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func histogramCount(t *testing.T, vec *prometheus.HistogramVec, labels ...string) uint64 {
+	t.Helper()
+	metric, ok := vec.WithLabelValues(labels...).(prometheus.Histogram)
+	require.True(t, ok)
+	var m dto.Metric
+	require.NoError(t, metric.Write(&m))
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestListLogsHandlerMetrics(t *testing.T) {
+	const stream = "metrics-test-logs"
+	testFile, err := os.ReadFile(logFile1)
+	require.NoError(t, err)
+
+	mockClient := &mockS3Client{
+		ListObjectsV2Func: func(_ context.Context, _ *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+			return &s3.ListObjectsV2Output{Contents: []types.Object{
+				{Key: aws.String("valid.json"), LastModified: aws.Time(time.Now())},
+				{Key: aws.String("corrupt.json"), LastModified: aws.Time(time.Now())},
+			}}, nil
+		},
+		GetObjectFunc: func(_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+			body := testFile
+			if *params.Key == "corrupt.json" {
+				body = []byte("{not json")
+			}
+			return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(body))}, nil
+		},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/logs/"+stream+"/files?start=1737080400000&end=1737080400000", http.NoBody)
+	rr := httptest.NewRecorder()
+	NewRouter(newTestRegistry(t, mockClient), DefaultLimits()).ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	assert.Equal(t, uint64(1), histogramCount(t, logsRequestDuration, stream, outcomeOK))
+	assert.Equal(t, uint64(1), histogramCount(t, storageOperationDuration, stream, "list", outcomeOK))
+	assert.Equal(t, uint64(2), histogramCount(t, storageOperationDuration, stream, "get", outcomeOK))
+	assert.Equal(t, uint64(1), histogramCount(t, parseDuration, stream, outcomeOK))
+	assert.Equal(t, uint64(1), histogramCount(t, parseDuration, stream, outcomeError))
+	assert.InDelta(t, float64(len(testFile)+len("{not json")), testutil.ToFloat64(storageBytesDownloaded.WithLabelValues(stream)), 0)
+	assert.Positive(t, testutil.ToFloat64(recordsReturned.WithLabelValues(stream)))
+}
+
+func TestObservedSet(t *testing.T) {
+	set := newObservedSet(2)
+	assert.True(t, set.add("a"))
+	assert.False(t, set.add("a"))
+	assert.True(t, set.add("b"))
+	assert.True(t, set.add("c"), "the oldest key is forgotten once the set is full")
+	assert.True(t, set.add("a"))
+	assert.False(t, set.add("c"))
+}
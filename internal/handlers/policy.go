@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"path"
+	"slices"
+
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/auth"
+)
+
+// anyPrincipal matches every authenticated principal in Policy.Principals.
+const anyPrincipal = "*"
+
+// recordFields are the LogRecord fields policies can constrain, by their JSON name. They are compared on the plain
+// attribute values. hubName falls back to mdaiHub, which names the hub in the records of the MDAI operator.
+var recordFields = map[string]func(LogRecord) string{
+	"hubName":        func(r LogRecord) string { return cmp.Or(r.attrs.hubName, r.attrs.mdaiHub) },
+	"namespace":      func(r LogRecord) string { return r.attrs.namespace },
+	"serviceName":    func(r LogRecord) string { return r.attrs.serviceName },
+	"pod":            func(r LogRecord) string { return r.attrs.pod },
+	"controller":     func(r LogRecord) string { return r.attrs.controller },
+	"controllerKind": func(r LogRecord) string { return r.attrs.controllerKind },
+	"name":           func(r LogRecord) string { return r.attrs.name },
+}
+
+// Policy grants the principals it matches access to streams, optionally restricted to the records of some hubs or
+// namespaces.
+type Policy struct {
+	// Principals lists principal names, or "*" for any authenticated caller.
+	Principals []string `yaml:"principals,omitempty"`
+	// Claims matches JWT claims, e.g. groups: [team-a]; a claim matches when it holds one of the values.
+	Claims map[string][]string `yaml:"claims,omitempty"`
+	// Streams lists stream names or path.Match patterns, e.g. "team-a-*".
+	Streams []string `yaml:"streams"`
+	// Records restricts the records served to those whose fields, e.g. hubName or namespace, hold one of the values.
+	// Every field listed must match. Without Records, every record of the streams is served.
+	Records map[string][]string `yaml:"records,omitempty"`
+}
+
+// Policies authorize requests once any is configured. A principal may read a record when a policy matching the
+// principal and the stream allows it; streams no policy grants are forbidden.
+type Policies []Policy
+
+func (p Policy) Validate() error {
+	var errs []error
+	if len(p.Principals) == 0 && len(p.Claims) == 0 {
+		errs = append(errs, errors.New("principals or claims must be provided"))
+	}
+	if len(p.Streams) == 0 {
+		errs = append(errs, errors.New("streams must be provided"))
+	}
+	for _, pattern := range p.Streams {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Errorf("invalid stream pattern %q", pattern))
+		}
+	}
+	for _, field := range slices.Sorted(maps.Keys(p.Records)) {
+		if _, ok := recordFields[field]; !ok {
+			errs = append(errs, fmt.Errorf("unsupported record field %q, must be one of %v", field,
+				slices.Sorted(maps.Keys(recordFields))))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (p Policy) matchesPrincipal(principal auth.Principal) bool {
+	if slices.Contains(p.Principals, anyPrincipal) || slices.Contains(p.Principals, principal.Name) {
+		return true
+	}
+	for claim, values := range p.Claims {
+		switch value := principal.Claims[claim].(type) {
+		case string:
+			if slices.Contains(values, value) {
+				return true
+			}
+		case []any:
+			for _, v := range value {
+				if s, ok := v.(string); ok && slices.Contains(values, s) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (p Policy) matchesStream(name string) bool {
+	return slices.ContainsFunc(p.Streams, func(pattern string) bool {
+		matched, _ := path.Match(pattern, name)
+		return matched
+	})
+}
+
+func (p Policy) allowsRecord(record LogRecord) bool {
+	for field, values := range p.Records {
+		if !slices.Contains(values, recordFields[field](record)) {
+			return false
+		}
+	}
+	return true
+}
+
+// access is what the policies grant the principal of a request.
+type access struct {
+	principal auth.Principal
+	policies  Policies
+}
+
+type accessKey struct{}
+
+// withAccess attaches the policies granted to principal to ctx. Requests without access are not restricted.
+func withAccess(ctx context.Context, policies Policies, principal auth.Principal) context.Context {
+	var granted Policies
+	for _, policy := range policies {
+		if policy.matchesPrincipal(principal) {
+			granted = append(granted, policy)
+		}
+	}
+	return context.WithValue(ctx, accessKey{}, access{principal: principal, policies: granted})
+}
+
+// streamGrants returns the policies granting the caller the stream, which decide the records it may read.
+func streamGrants(ctx context.Context, stream string) Policies {
+	a, ok := ctx.Value(accessKey{}).(access)
+	if !ok {
+		return nil
+	}
+	var grants Policies
+	for _, policy := range a.policies {
+		if policy.matchesStream(stream) {
+			grants = append(grants, policy)
+		}
+	}
+	return grants
+}
+
+// recordFilter reports whether a record of the stream may be served.
+type recordFilter func(LogRecord) bool
+
+// authorizeStream returns the filter for the records of the stream that the caller may read, and false when the caller
+// may not read the stream at all.
+func authorizeStream(ctx context.Context, stream string) (recordFilter, bool) {
+	a, ok := ctx.Value(accessKey{}).(access)
+	if !ok {
+		return nil, true
+	}
+	var constrained []Policy
+	for _, policy := range a.policies {
+		if !policy.matchesStream(stream) {
+			continue
+		}
+		if len(policy.Records) == 0 {
+			return nil, true
+		}
+		constrained = append(constrained, policy)
+	}
+	if len(constrained) == 0 {
+		return nil, false
+	}
+	return func(record LogRecord) bool {
+		return slices.ContainsFunc(constrained, func(p Policy) bool { return p.allowsRecord(record) })
+	}, true
+}
+
+// filterRecords returns the records filter accepts; a nil filter keeps every record. records is left untouched, as it
+// may be shared with other requests.
+func filterRecords(records []LogRecord, filter recordFilter) []LogRecord {
+	if filter == nil {
+		return records
+	}
+	var filtered []LogRecord
+	for _, record := range records {
+		if filter(record) {
+			filtered = append(filtered, record)
+		}
+	}
+	return filtered
+}
+
+// writeForbidden responds with 403 to callers that no policy grants the stream.
+func writeForbidden(ctx context.Context, w http.ResponseWriter, stream string) {
+	if a, ok := ctx.Value(accessKey{}).(access); ok {
+		logger(ctx).Warn("denied access to stream", "principal", a.principal.Name, "stream", stream)
+	}
+	http.Error(w, "Forbidden: no access to stream "+stream, http.StatusForbidden)
+}
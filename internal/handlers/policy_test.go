@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/auth"
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testPolicies = Policies{
+	{Principals: []string{"platform"}, Streams: []string{"*"}},
+	{Principals: []string{"team-a"}, Streams: []string{"team-a-*"}},
+	{
+		Claims:  map[string][]string{"groups": {"team-a"}},
+		Streams: []string{"audit"},
+		Records: map[string][]string{"hubName": {"hub-a"}, "namespace": {"team-a", "shared"}},
+	},
+}
+
+func TestAuthorizeStream(t *testing.T) {
+	records := []LogRecord{
+		{Body: "a", attrs: recordAttrs{hubName: "hub-a", namespace: "team-a"}},
+		{Body: "b", attrs: recordAttrs{mdaiHub: "hub-a", namespace: "shared"}},
+		{Body: "c", attrs: recordAttrs{hubName: "hub-a", namespace: "team-b"}},
+		{Body: "d", attrs: recordAttrs{hubName: "hub-b", namespace: "team-a"}},
+	}
+	teamA := auth.Principal{Name: "alice", Method: auth.MethodJWT, Claims: map[string]any{"groups": []any{"team-a", "dev"}}}
+
+	tests := []struct {
+		name        string
+		principal   auth.Principal
+		stream      string
+		wantAllowed bool
+		wantBodies  []string
+	}{
+		{name: "WildcardStream", principal: auth.Principal{Name: "platform"}, stream: "audit", wantAllowed: true, wantBodies: []string{"a", "b", "c", "d"}},
+		{name: "StreamPattern", principal: auth.Principal{Name: "team-a"}, stream: "team-a-audit", wantAllowed: true, wantBodies: []string{"a", "b", "c", "d"}},
+		{name: "StreamNotGranted", principal: auth.Principal{Name: "team-a"}, stream: "audit"},
+		{name: "RecordConstraints", principal: teamA, stream: "audit", wantAllowed: true, wantBodies: []string{"a", "b"}},
+		{name: "NoPolicy", principal: auth.Principal{Name: "stranger"}, stream: "audit"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := withAccess(t.Context(), testPolicies, tt.principal)
+			filter, allowed := authorizeStream(ctx, tt.stream)
+			require.Equal(t, tt.wantAllowed, allowed)
+			if !allowed {
+				return
+			}
+			var bodies []string
+			for _, record := range filterRecords(append([]LogRecord(nil), records...), filter) {
+				bodies = append(bodies, record.Body)
+			}
+			assert.Equal(t, tt.wantBodies, bodies)
+		})
+	}
+
+	_, allowed := authorizeStream(t.Context(), "audit")
+	assert.True(t, allowed, "requests are not restricted without policies")
+}
+
+func TestPoliciesInRouter(t *testing.T) {
+	keys, err := auth.ParseAPIKeys([]byte("platform:p\nteam-a:a\n"))
+	require.NoError(t, err)
+	store := storage.NewFS(fstest.MapFS{}, "memory")
+	registry, err := NewRegistry(nil, Stream{Name: "audit", Store: store}, Stream{Name: "team-a-audit", Store: store})
+	require.NoError(t, err)
+	router := NewRuntimeRouter(NewRuntime(Settings{
+		Registry:      registry,
+		Limits:        DefaultLimits(),
+		Authenticator: auth.Chain{keys},
+		Policies:      testPolicies,
+	}))
+
+	get := func(path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, http.NoBody)
+		req.Header.Set(auth.APIKeyHeader, key)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	const logsQuery = "/files?start=1737080400000&end=1737084000000"
+	assert.Equal(t, http.StatusForbidden, get("/logs/audit"+logsQuery, "a").Code)
+	assert.Equal(t, http.StatusOK, get("/logs/team-a-audit"+logsQuery, "a").Code)
+	assert.Equal(t, http.StatusForbidden, get("/streams/audit/coverage?start=1737080400000&end=1737084000000", "a").Code)
+
+	var streams []StreamInfo
+	require.NoError(t, json.Unmarshal(get("/streams", "a").Body.Bytes(), &streams))
+	assert.Equal(t, []StreamInfo{{Name: "team-a-audit"}}, streams)
+	require.NoError(t, json.Unmarshal(get("/streams", "p").Body.Bytes(), &streams))
+	assert.Len(t, streams, 2)
+}
+
+func TestPolicyValidate(t *testing.T) {
+	require.NoError(t, testPolicies[2].Validate())
+	err := Policy{Streams: []string{"[a"}, Records: map[string][]string{"severity": {"ERROR"}}}.Validate()
+	require.EqualError(t, err, "principals or claims must be provided\n"+
+		"invalid stream pattern \"[a\"\n"+
+		"unsupported record field \"severity\", must be one of "+
+		"[controller controllerKind hubName name namespace pod serviceName]")
+}
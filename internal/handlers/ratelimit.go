@@ -0,0 +1,367 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/auth"
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultRequestsPerSecond    = 10
+	defaultBurst                = 50
+	defaultMaxConcurrentQueries = 16
+	defaultMaxQueuedQueries     = 64
+	defaultQueueTimeout         = 15 * time.Second
+
+	// clientIdleTimeout is how long the token bucket of a client that stopped sending requests is kept.
+	clientIdleTimeout = 10 * time.Minute
+	// queueRetryAfter is suggested to clients turned away because too many queries are running or queued.
+	queueRetryAfter = time.Second
+)
+
+// Reasons used as the "reason" label of rejected requests.
+const (
+	reasonRateLimited  = "rate_limited"
+	reasonQueueFull    = "queue_full"
+	reasonQueueTimeout = "queue_timeout"
+)
+
+var (
+	errQueueFull    = errors.New("too many queries are queued")
+	errQueueTimeout = errors.New("timed out waiting for a query slot")
+)
+
+// RateLimits protects the stores and the pod from clients sending more queries than they can serve, e.g. dashboards
+// with many panels and a short refresh interval.
+type RateLimits struct {
+	// RequestsPerSecond is the sustained rate of API requests allowed per client, identified by its principal or, for
+	// anonymous requests, its IP address. 0 disables rate limiting.
+	RequestsPerSecond float64 `yaml:"requestsPerSecond"`
+	// Burst is the number of requests a client may send at once.
+	Burst int `yaml:"burst"`
+	// MaxConcurrentQueries bounds the logs, coverage and lag queries running at once across all clients. 0 disables
+	// the bound.
+	MaxConcurrentQueries int `yaml:"maxConcurrentQueries"`
+	// MaxQueuedQueries bounds the queries waiting for one of the MaxConcurrentQueries slots.
+	MaxQueuedQueries int `yaml:"maxQueuedQueries"`
+	// QueueTimeout is how long a query waits for a slot before it is rejected.
+	QueueTimeout time.Duration `yaml:"queueTimeout"`
+	// Streams overrides the rate of the requests for specific streams, which get a token bucket of their own.
+	Streams map[string]StreamRateLimit `yaml:"streams,omitempty"`
+	// ClientIPHeader names a header, e.g. X-Forwarded-For, whose last address identifies anonymous clients instead of
+	// the address the request came from, which is the proxy's when the server is behind one: all anonymous clients
+	// would then share a bucket. Only set it when every request goes through a proxy setting the header, as clients
+	// could otherwise pick their bucket.
+	ClientIPHeader string `yaml:"clientIPHeader,omitempty"`
+}
+
+type StreamRateLimit struct {
+	RequestsPerSecond float64 `yaml:"requestsPerSecond"`
+	Burst             int     `yaml:"burst"`
+}
+
+func DefaultRateLimits() RateLimits {
+	return RateLimits{
+		RequestsPerSecond:    defaultRequestsPerSecond,
+		Burst:                defaultBurst,
+		MaxConcurrentQueries: defaultMaxConcurrentQueries,
+		MaxQueuedQueries:     defaultMaxQueuedQueries,
+		QueueTimeout:         defaultQueueTimeout,
+	}
+}
+
+// rateLimiter keeps the token buckets of the clients and the query slots across configuration reloads.
+type rateLimiter struct {
+	now func() time.Time
+
+	mu        sync.Mutex
+	limits    RateLimits
+	clients   map[string]*clientBucket
+	lastSweep time.Time
+
+	queries *querySlots
+}
+
+type clientBucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newRateLimiter(limits RateLimits) *rateLimiter {
+	l := &rateLimiter{now: time.Now, clients: map[string]*clientBucket{}, queries: &querySlots{}}
+	l.configure(limits)
+	return l
+}
+
+// configure applies new limits; the buckets of known clients are updated in place.
+func (l *rateLimiter) configure(limits RateLimits) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits = limits
+	for key, bucket := range l.clients {
+		limit, burst := l.bucketLimits(streamOfKey(key))
+		bucket.limiter.SetLimit(limit)
+		bucket.limiter.SetBurst(burst)
+	}
+	l.queries.configure(limits.MaxConcurrentQueries, limits.MaxQueuedQueries)
+}
+
+func (l *rateLimiter) bucketLimits(stream string) (rate.Limit, int) {
+	if override, ok := l.limits.Streams[stream]; ok && stream != "" {
+		return rate.Limit(override.RequestsPerSecond), override.Burst
+	}
+	return rate.Limit(l.limits.RequestsPerSecond), l.limits.Burst
+}
+
+// allow takes a token from the bucket of the client for the stream, which is empty for requests not about a stream.
+// When the bucket is empty, it returns how long the client should wait.
+func (l *rateLimiter) allow(client, stream string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.limits.Streams[stream]; !ok {
+		stream = ""
+	}
+	limit, burst := l.bucketLimits(stream)
+	if limit <= 0 {
+		return 0, true
+	}
+
+	now := l.now()
+	l.sweep(now)
+	key := client + "\x00" + stream
+	bucket, ok := l.clients[key]
+	if !ok {
+		bucket = &clientBucket{limiter: rate.NewLimiter(limit, burst)}
+		l.clients[key] = bucket
+	}
+	bucket.lastSeen = now
+
+	reservation := bucket.limiter.ReserveN(now, 1)
+	if !reservation.OK() {
+		return time.Second, false
+	}
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		return delay, false
+	}
+	return 0, true
+}
+
+// sweep forgets the clients that have been idle for a while, so that the buckets of past clients do not pile up.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < clientIdleTimeout {
+		return
+	}
+	l.lastSweep = now
+	for key, bucket := range l.clients {
+		if now.Sub(bucket.lastSeen) >= clientIdleTimeout {
+			delete(l.clients, key)
+		}
+	}
+}
+
+func streamOfKey(key string) string {
+	_, stream, _ := strings.Cut(key, "\x00")
+	return stream
+}
+
+// acquireQuery waits for a query slot, for up to the queue timeout. The returned function releases the slot.
+func (l *rateLimiter) acquireQuery(ctx context.Context) (func(), error) {
+	return l.queries.acquire(ctx, l.queueTimeout())
+}
+
+func (l *rateLimiter) queueTimeout() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limits.QueueTimeout
+}
+
+// querySlots is a semaphore with a bounded FIFO queue whose size can change while it is in use.
+type querySlots struct {
+	mu        sync.Mutex
+	max       int
+	maxQueued int
+	running   int
+	waiting   []chan struct{}
+}
+
+func (q *querySlots) configure(maxRunning, maxQueued int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.max, q.maxQueued = maxRunning, maxQueued
+	q.grant()
+}
+
+// grant hands the free slots to the queries waiting the longest. It must be called with q.mu held.
+func (q *querySlots) grant() {
+	for len(q.waiting) > 0 && (q.max <= 0 || q.running < q.max) {
+		q.running++
+		close(q.waiting[0])
+		q.waiting = q.waiting[1:]
+	}
+	queriesRunning.Set(float64(q.running))
+	queriesQueued.Set(float64(len(q.waiting)))
+}
+
+func (q *querySlots) acquire(ctx context.Context, timeout time.Duration) (func(), error) {
+	q.mu.Lock()
+	if q.max <= 0 || (q.running < q.max && len(q.waiting) == 0) {
+		q.running++
+		q.grant()
+		q.mu.Unlock()
+		return q.release, nil
+	}
+	if len(q.waiting) >= q.maxQueued {
+		q.mu.Unlock()
+		return nil, errQueueFull
+	}
+	granted := make(chan struct{})
+	q.waiting = append(q.waiting, granted)
+	queriesQueued.Set(float64(len(q.waiting)))
+	q.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-granted:
+		return q.release, nil
+	case <-timer.C:
+		err = errQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if i := slices.Index(q.waiting, granted); i >= 0 {
+		q.waiting = slices.Delete(q.waiting, i, i+1)
+		q.grant()
+		return nil, err
+	}
+	// The slot was granted while giving up; hand it over to the next query.
+	q.running--
+	q.grant()
+	return nil, err
+}
+
+func (q *querySlots) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.running--
+	q.grant()
+}
+
+// rateLimited rejects the requests of clients over their rate and, for heavy queries, makes the query slots available
+// to h, which takes one with acquireQuery around the actual load: identical requests sharing a load share its slot.
+func rateLimited(rt *Runtime, heavy bool, h settingsHandler) settingsHandler {
+	return func(w http.ResponseWriter, r *http.Request, s *Settings) {
+		stream := r.PathValue("stream")
+		if stream == "" {
+			stream = r.PathValue("auditPath")
+		}
+
+		client := rt.limiter.clientKey(r)
+		if retryAfter, ok := rt.limiter.allow(client, stream); !ok {
+			rejectRequest(w, r, client, reasonRateLimited, retryAfter)
+			return
+		}
+		if heavy {
+			r = r.WithContext(context.WithValue(r.Context(), querySlotsKey{}, rt.limiter))
+		}
+		h(w, r, s)
+	}
+}
+
+type querySlotsKey struct{}
+
+// acquireQuery waits for a query slot of the limiter made available to ctx by rateLimited; without one, queries are not
+// bounded. The returned function releases the slot.
+func acquireQuery(ctx context.Context) (func(), error) {
+	limiter, ok := ctx.Value(querySlotsKey{}).(*rateLimiter)
+	if !ok {
+		return func() {}, nil
+	}
+	return limiter.acquireQuery(ctx)
+}
+
+// queueTimeout is how long acquireQuery may wait for a slot with ctx.
+func queueTimeout(ctx context.Context) time.Duration {
+	limiter, ok := ctx.Value(querySlotsKey{}).(*rateLimiter)
+	if !ok {
+		return 0
+	}
+	return limiter.queueTimeout()
+}
+
+// rejectQuery answers a request whose query got no slot with err. It reports false for other errors, e.g. the client
+// going away while waiting, leaving the response to the caller.
+func rejectQuery(w http.ResponseWriter, r *http.Request, err error) bool {
+	limiter, ok := r.Context().Value(querySlotsKey{}).(*rateLimiter)
+	if !ok {
+		return false
+	}
+	switch {
+	case errors.Is(err, errQueueFull):
+		rejectRequest(w, r, limiter.clientKey(r), reasonQueueFull, queueRetryAfter)
+	case errors.Is(err, errQueueTimeout):
+		rejectRequest(w, r, limiter.clientKey(r), reasonQueueTimeout, queueRetryAfter)
+	default:
+		return false
+	}
+	return true
+}
+
+// clientKey identifies the client of a request by its principal or, for anonymous requests, its IP address.
+func (l *rateLimiter) clientKey(r *http.Request) string {
+	if principal, ok := auth.PrincipalFrom(r.Context()); ok {
+		return "principal:" + principal.Name
+	}
+	l.mu.Lock()
+	header := l.limits.ClientIPHeader
+	l.mu.Unlock()
+	if header != "" {
+		if addr, ok := forwardedAddr(r.Header.Values(header)); ok {
+			return "ip:" + addr.String()
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// forwardedAddr returns the last address of a header listing the addresses a request was forwarded for, the one set
+// by the proxy in front of the server; the others come from the client.
+func forwardedAddr(values []string) (netip.Addr, bool) {
+	if len(values) == 0 {
+		return netip.Addr{}, false
+	}
+	list := values[len(values)-1]
+	addr, err := netip.ParseAddr(strings.TrimSpace(list[strings.LastIndex(list, ",")+1:]))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+func rejectRequest(w http.ResponseWriter, r *http.Request, client, reason string, retryAfter time.Duration) {
+	requestsRejected.WithLabelValues(reason).Inc()
+	logger(r.Context()).Warn("rejected request", "reason", reason, "client", client,
+		"retry_after", retryAfter.String())
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	http.Error(w, "Too many requests, retry later", http.StatusTooManyRequests)
+}
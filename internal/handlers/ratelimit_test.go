@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/auth"
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitedRequests(t *testing.T) {
+	store := storage.NewFS(fstest.MapFS{}, "memory")
+	registry, err := NewRegistry(nil, Stream{Name: "audit", Store: store}, Stream{Name: "billing", Store: store})
+	require.NoError(t, err)
+	rt := NewRuntime(Settings{Registry: registry, Limits: DefaultLimits(), RateLimits: RateLimits{
+		RequestsPerSecond: 0.5,
+		Burst:             2,
+		Streams:           map[string]StreamRateLimit{"billing": {RequestsPerSecond: 0.1, Burst: 1}},
+	}})
+	now := time.Date(2025, 1, 17, 2, 0, 0, 0, time.UTC)
+	rt.limiter.now = func() time.Time { return now }
+	router := NewRuntimeRouter(rt)
+
+	get := func(path, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, http.NoBody)
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	assert.Equal(t, http.StatusOK, get("/streams", "10.0.0.1:1234").Code)
+	assert.Equal(t, http.StatusNotFound, get("/streams/other/lag", "10.0.0.1:1235").Code)
+	rr := get("/streams", "10.0.0.1:1236")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "2", rr.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, get("/streams", "10.0.0.2:1234").Code, "clients have buckets of their own")
+
+	billing := "/streams/billing/coverage?start=1737080400000&end=1737084000000"
+	assert.Equal(t, http.StatusOK, get(billing, "10.0.0.1:1234").Code, "overridden streams have buckets of their own")
+	rr = get(billing, "10.0.0.1:1234")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "10", rr.Header().Get("Retry-After"))
+
+	now = now.Add(2 * time.Second)
+	assert.Equal(t, http.StatusOK, get("/streams", "10.0.0.1:1234").Code, "buckets refill over time")
+
+	rt.Swap(Settings{Registry: registry, Limits: DefaultLimits()})
+	for range 5 {
+		assert.Equal(t, http.StatusOK, get(billing, "10.0.0.1:1234").Code, "reloaded limits apply")
+	}
+}
+
+func TestClientKey(t *testing.T) {
+	const xff = "X-Forwarded-For"
+	tests := []struct {
+		name      string
+		header    string
+		forwarded []string
+		principal string
+		want      string
+	}{
+		{name: "RemoteAddr", forwarded: []string{"10.0.0.7"}, want: "ip:192.0.2.1"},
+		{name: "Principal", header: xff, forwarded: []string{"10.0.0.7"}, principal: "alice", want: "principal:alice"},
+		{name: "Forwarded", header: xff, forwarded: []string{"10.0.0.7"}, want: "ip:10.0.0.7"},
+		{name: "LastAddress", header: xff, forwarded: []string{"203.0.113.9, 10.0.0.7"}, want: "ip:10.0.0.7"},
+		{name: "LastHeader", header: xff, forwarded: []string{"203.0.113.9", "10.0.0.8"}, want: "ip:10.0.0.8"},
+		{name: "IPv6", header: xff, forwarded: []string{"2001:db8::1"}, want: "ip:2001:db8::1"},
+		{name: "Invalid", header: xff, forwarded: []string{"10.0.0.7, unknown"}, want: "ip:192.0.2.1"},
+		{name: "Missing", header: "X-Real-IP", forwarded: []string{"10.0.0.7"}, want: "ip:192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := newRateLimiter(RateLimits{ClientIPHeader: tt.header})
+			req := httptest.NewRequest(http.MethodGet, "/streams", http.NoBody)
+			req.RemoteAddr = "192.0.2.1:1234"
+			for _, addr := range tt.forwarded {
+				req.Header.Add(xff, addr)
+			}
+			if tt.principal != "" {
+				req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{Name: tt.principal}))
+			}
+			assert.Equal(t, tt.want, limiter.clientKey(req))
+		})
+	}
+}
+
+func TestQuerySlots(t *testing.T) {
+	slots := &querySlots{}
+	slots.configure(1, 1)
+
+	release, err := slots.acquire(t.Context(), time.Second)
+	require.NoError(t, err)
+
+	acquired := make(chan func())
+	go func() {
+		release, err := slots.acquire(t.Context(), time.Minute)
+		assert.NoError(t, err)
+		acquired <- release
+	}()
+	require.Eventually(t, func() bool {
+		slots.mu.Lock()
+		defer slots.mu.Unlock()
+		return len(slots.waiting) == 1
+	}, time.Second, time.Millisecond)
+
+	_, err = slots.acquire(t.Context(), time.Second)
+	require.ErrorIs(t, err, errQueueFull)
+
+	release()
+	queued := <-acquired
+	_, err = slots.acquire(t.Context(), 10*time.Millisecond)
+	require.ErrorIs(t, err, errQueueTimeout)
+
+	queued()
+	release, err = slots.acquire(t.Context(), time.Second)
+	require.NoError(t, err)
+	release()
+	assert.Equal(t, 0, slots.running)
+}
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/storage"
+)
+
+const (
+	DefaultPrefixTemplate = "{stream}/{year}/{month}/{day}/{hour}/"
+	FormatOTLPJSON        = "otlp_json"
+
+	streamPlaceholder = "{stream}"
+	yearPlaceholder   = "{year}"
+
+	// maxStreamNameLength keeps stream names within the length of a Kubernetes resource name.
+	maxStreamNameLength = 253
+)
+
+var (
+	partitionPlaceholders = []string{yearPlaceholder, "{month}", "{day}", "{hour}"}
+	partitionLayouts      = strings.NewReplacer(yearPlaceholder, "2006", "{month}", "01", "{day}", "02", "{hour}", "15")
+	supportedFormats      = []string{FormatOTLPJSON}
+)
+
+// Stream binds a stream name to the store and key layout its objects are exported to.
+type Stream struct {
+	Name  string
+	Store storage.Store
+	// PrefixTemplate describes the key prefix of an hourly partition, e.g. "{stream}/{year}/{month}/{day}/{hour}/".
+	PrefixTemplate string
+	Format         string
+	// Patterns, on the fallback stream only, lists the path.Match patterns of the undeclared stream names it serves.
+	// Without patterns the fallback serves no stream.
+	Patterns []string
+}
+
+// Registry resolves stream names to their storage location. Streams that are not declared are served by the
+// fallback stream, when there is one, with the requested name substituted into its prefix template.
+type Registry struct {
+	streams  map[string]Stream
+	fallback *Stream
+}
+
+func NewRegistry(fallback *Stream, streams ...Stream) (*Registry, error) {
+	registry := &Registry{streams: make(map[string]Stream, len(streams))}
+
+	if fallback != nil {
+		fb := fallback.withDefaults()
+		if err := fb.validate(); err != nil {
+			return nil, fmt.Errorf("fallback stream: %w", err)
+		}
+		if !strings.Contains(fb.PrefixTemplate, streamPlaceholder) {
+			return nil, fmt.Errorf("fallback stream: prefix template %q must contain %s", fb.PrefixTemplate, streamPlaceholder)
+		}
+		for _, pattern := range fb.Patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("fallback stream: invalid pattern %q", pattern)
+			}
+		}
+		registry.fallback = &fb
+	}
+
+	for _, stream := range streams {
+		stream = stream.withDefaults()
+		if stream.Name == "" {
+			return nil, errors.New("stream name must be provided")
+		}
+		if err := ValidateStreamName(stream.Name); err != nil {
+			return nil, fmt.Errorf("stream %q: %w", stream.Name, err)
+		}
+		if _, found := registry.streams[stream.Name]; found {
+			return nil, fmt.Errorf("stream %s is declared more than once", stream.Name)
+		}
+		if err := stream.validate(); err != nil {
+			return nil, fmt.Errorf("stream %s: %w", stream.Name, err)
+		}
+		registry.streams[stream.Name] = stream
+	}
+
+	return registry, nil
+}
+
+// Lookup returns the declared stream called name or, when name matches one of its patterns, the fallback stream.
+func (r *Registry) Lookup(name string) (Stream, bool) {
+	if stream, found := r.streams[name]; found {
+		return stream, true
+	}
+	if r.fallback == nil || ValidateStreamName(name) != nil || !r.fallback.matches(name) {
+		return Stream{}, false
+	}
+	stream := *r.fallback
+	stream.Name = name
+	return stream, true
+}
+
+// Streams returns the declared streams ordered by name.
+func (r *Registry) Streams() []Stream {
+	names := slices.Sorted(maps.Keys(r.streams))
+	streams := make([]Stream, 0, len(names))
+	for _, name := range names {
+		streams = append(streams, r.streams[name])
+	}
+	return streams
+}
+
+// Locations returns one stream per distinct store, the fallback first.
+func (r *Registry) Locations() []Stream {
+	candidates := r.Streams()
+	if r.fallback != nil {
+		candidates = append([]Stream{*r.fallback}, candidates...)
+	}
+
+	seen := map[storage.Store]bool{}
+	var locations []Stream
+	for _, stream := range candidates {
+		if !seen[stream.Store] {
+			seen[stream.Store] = true
+			locations = append(locations, stream)
+		}
+	}
+	return locations
+}
+
+func (r *Registry) Fallback() (Stream, bool) {
+	if r.fallback == nil {
+		return Stream{}, false
+	}
+	return *r.fallback, true
+}
+
+func (s Stream) matches(name string) bool {
+	return slices.ContainsFunc(s.Patterns, func(pattern string) bool {
+		matched, _ := path.Match(pattern, name)
+		return matched
+	})
+}
+
+// ValidateStreamName rejects names that could escape the prefix of their stream once substituted into a prefix
+// template, e.g. "..", "a/b" or "a*": names are made of letters, digits, ".", "_" and "-", starting with a letter or
+// digit.
+func ValidateStreamName(name string) error {
+	if name == "" || len(name) > maxStreamNameLength {
+		return fmt.Errorf("must be between 1 and %d characters long", maxStreamNameLength)
+	}
+	for i, c := range name {
+		alphanumeric := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+		if !alphanumeric && (i == 0 || (c != '.' && c != '_' && c != '-')) {
+			return errors.New("must only contain letters, digits, '.', '_' and '-', starting with a letter or digit")
+		}
+	}
+	if strings.Contains(name, "..") {
+		return errors.New("must not contain \"..\"")
+	}
+	return nil
+}
+
+func (s Stream) withDefaults() Stream {
+	if s.PrefixTemplate == "" {
+		s.PrefixTemplate = DefaultPrefixTemplate
+	}
+	if s.Format == "" {
+		s.Format = FormatOTLPJSON
+	}
+	return s
+}
+
+func (s Stream) validate() error {
+	if s.Store == nil {
+		return errors.New("store must be provided")
+	}
+	if !slices.Contains(supportedFormats, s.Format) {
+		return fmt.Errorf("unsupported format %q, must be one of %v", s.Format, supportedFormats)
+	}
+	return validatePrefixTemplate(s.PrefixTemplate)
+}
+
+// validatePrefixTemplate requires the partition placeholders to appear in order at the end of the template, separated
+// only by "/", "-" or "_", so that the partition part can be used as a time layout.
+func validatePrefixTemplate(template string) error {
+	root, partition, found := strings.Cut(template, yearPlaceholder)
+	if !found {
+		return fmt.Errorf("prefix template %q must contain %s", template, yearPlaceholder)
+	}
+	partition = yearPlaceholder + partition
+	if strings.Contains(partition, streamPlaceholder) {
+		return fmt.Errorf("prefix template %q must place %s before the time placeholders", template, streamPlaceholder)
+	}
+	if strings.Count(root, streamPlaceholder) > 1 {
+		return fmt.Errorf("prefix template %q must contain %s at most once", template, streamPlaceholder)
+	}
+	if !strings.HasSuffix(template, prefixDelimiter) {
+		return fmt.Errorf("prefix template %q must end with %q", template, prefixDelimiter)
+	}
+
+	rest := partition
+	for _, placeholder := range partitionPlaceholders {
+		before, after, found := strings.Cut(rest, placeholder)
+		if !found {
+			return fmt.Errorf("prefix template %q must contain %v in this order", template, partitionPlaceholders)
+		}
+		if strings.Trim(before, "/-_") != "" {
+			return fmt.Errorf("prefix template %q may only separate time placeholders with \"/\", \"-\" or \"_\"", template)
+		}
+		rest = after
+	}
+	if strings.Trim(rest, "/-_") != "" {
+		return fmt.Errorf("prefix template %q may only separate time placeholders with \"/\", \"-\" or \"_\"", template)
+	}
+	return nil
+}
+
+// HourPrefix returns the key prefix of the partition holding the hour of t.
+func (s Stream) HourPrefix(t time.Time) string {
+	return s.partitionRoot() + t.UTC().Format(s.partitionLayout())
+}
+
+// partitionRoot is the static prefix below which the time partitions of the stream start.
+func (s Stream) partitionRoot() string {
+	root, _, _ := strings.Cut(s.PrefixTemplate, yearPlaceholder)
+	return strings.ReplaceAll(root, streamPlaceholder, s.Name)
+}
+
+func (s Stream) partitionLayout() string {
+	_, partition, _ := strings.Cut(s.PrefixTemplate, yearPlaceholder)
+	return partitionLayouts.Replace(yearPlaceholder + partition)
+}
+
+// partitionDepth is the number of prefix levels between the partition root and an hourly partition.
+func (s Stream) partitionDepth() int {
+	return strings.Count(s.partitionLayout(), prefixDelimiter)
+}
+
+// discoveryRoot is the prefix whose "directories" are stream names, if the template starts with a stream name.
+func (s Stream) discoveryRoot() (string, bool) {
+	root, rest, found := strings.Cut(s.PrefixTemplate, streamPlaceholder)
+	if !found || !strings.HasPrefix(rest, prefixDelimiter) {
+		return "", false
+	}
+	return root, true
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRegistry(t *testing.T) {
+	store := storage.NewS3(&mockS3Client{}, bucket)
+	tests := []struct {
+		name     string
+		fallback *Stream
+		streams  []Stream
+		err      string
+	}{
+		{
+			name:     "FallbackOnly",
+			fallback: &Stream{Store: store},
+		},
+		{
+			name:    "DeclaredStreams",
+			streams: []Stream{{Name: "audit", Store: store, PrefixTemplate: "exports/{year}-{month}-{day}/{hour}/"}},
+		},
+		{
+			name:    "MissingName",
+			streams: []Stream{{Store: store}},
+			err:     "stream name must be provided",
+		},
+		{
+			name:    "Duplicate",
+			streams: []Stream{{Name: "audit", Store: store}, {Name: "audit", Store: store}},
+			err:     "stream audit is declared more than once",
+		},
+		{
+			name:    "MissingStore",
+			streams: []Stream{{Name: "audit"}},
+			err:     "stream audit: store must be provided",
+		},
+		{
+			name:    "UnsupportedFormat",
+			streams: []Stream{{Name: "audit", Store: store, Format: "csv"}},
+			err:     `stream audit: unsupported format "csv", must be one of [otlp_json]`,
+		},
+		{
+			name:    "MissingHour",
+			streams: []Stream{{Name: "audit", Store: store, PrefixTemplate: "{stream}/{year}/{month}/{day}/"}},
+			err:     `stream audit: prefix template "{stream}/{year}/{month}/{day}/" must contain [{year} {month} {day} {hour}] in this order`,
+		},
+		{
+			name:    "LiteralInPartition",
+			streams: []Stream{{Name: "audit", Store: store, PrefixTemplate: "{stream}/{year}/{month}/{day}/{hour}/v1/"}},
+			err:     `stream audit: prefix template "{stream}/{year}/{month}/{day}/{hour}/v1/" may only separate time placeholders with "/", "-" or "_"`,
+		},
+		{
+			name:    "InvalidName",
+			streams: []Stream{{Name: "../audit", Store: store}},
+			err:     `stream "../audit": must only contain letters, digits, '.', '_' and '-', starting with a letter or digit`,
+		},
+		{
+			name:     "InvalidPattern",
+			fallback: &Stream{Store: store, Patterns: []string{"hub-[*"}},
+			err:      `fallback stream: invalid pattern "hub-[*"`,
+		},
+		{
+			name:     "FallbackWithoutStreamPlaceholder",
+			fallback: &Stream{Store: store, PrefixTemplate: "{year}/{month}/{day}/{hour}/"},
+			err:      `fallback stream: prefix template "{year}/{month}/{day}/{hour}/" must contain {stream}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRegistry(tt.fallback, tt.streams...)
+			if tt.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestRegistryLookup(t *testing.T) {
+	store := storage.NewS3(&mockS3Client{}, bucket)
+	auditStore := storage.NewS3(&mockS3Client{}, "audit-bucket")
+	registry, err := NewRegistry(
+		&Stream{Store: store, Patterns: []string{"hub-*-logs"}},
+		Stream{Name: "audit", Store: auditStore, PrefixTemplate: "exports/{stream}/{year}-{month}-{day}/{hour}/"},
+	)
+	require.NoError(t, err)
+	hour := time.Date(2025, 1, 17, 2, 30, 0, 0, time.UTC)
+
+	audit, ok := registry.Lookup("audit")
+	require.True(t, ok)
+	assert.Equal(t, auditStore, audit.Store)
+	assert.Equal(t, "exports/audit/2025-01-17/02/", audit.HourPrefix(hour))
+	assert.Equal(t, 2, audit.partitionDepth())
+
+	other, ok := registry.Lookup("hub-monitor-hub-logs")
+	require.True(t, ok)
+	assert.Equal(t, store, other.Store)
+	assert.Equal(t, "hub-monitor-hub-logs/2025/01/17/02/", other.HourPrefix(hour))
+
+	_, ok = registry.Lookup("billing")
+	assert.False(t, ok, "undeclared streams must match a pattern")
+	_, ok = registry.Lookup("hub-../other-logs")
+	assert.False(t, ok, "invalid names are never served")
+
+	withoutFallback, err := NewRegistry(nil, audit)
+	require.NoError(t, err)
+	_, ok = withoutFallback.Lookup("hub-monitor-hub-logs")
+	assert.False(t, ok)
+}
+
+func TestValidateStreamName(t *testing.T) {
+	for _, name := range []string{"audit", "hub-monitor-hub-logs", "team_a.audit", "0"} {
+		require.NoError(t, ValidateStreamName(name), name)
+	}
+	for _, name := range []string{"", "..", "a..b", "a/b", "-audit", ".hidden", "audit*", "audit logs", "audit%2F"} {
+		require.Error(t, ValidateStreamName(name), name)
+	}
+}
+
+func TestListLogsHandlerInvalidStream(t *testing.T) {
+	registry, err := NewRegistry(&Stream{Store: storage.NewS3(&mockS3Client{}, bucket), Patterns: []string{"*"}})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/logs/..%2Fother-tenant/files?start=1737080400000&end=1737084000000", http.NoBody)
+	rr := httptest.NewRecorder()
+	NewRouter(registry, DefaultLimits()).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestListLogsHandlerUnknownStream(t *testing.T) {
+	registry, err := NewRegistry(nil, Stream{Name: "audit", Store: storage.NewS3(&mockS3Client{}, bucket)})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/logs/hub-monitor-hub-logs/files?start=1737080400000&end=1737084000000", http.NoBody)
+	rr := httptest.NewRecorder()
+	NewRouter(registry, DefaultLimits()).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/auth"
+)
+
+// Settings is the part of the configuration that can be replaced while the server is running.
+type Settings struct {
+	Registry *Registry
+	Limits   Limits
+	// Authenticator authenticates API requests. Requests are anonymous when it is nil.
+	Authenticator auth.Authenticator
+	// RateLimits bound the requests of each client and the queries running at once.
+	RateLimits RateLimits
+	// HourCache configures the caching of past hours.
+	HourCache HourCache
+	// Policies restrict the streams and records authenticated principals may read, once any is configured.
+	Policies Policies
+	// Version identifies the configuration the settings were loaded from.
+	Version  string
+	LoadedAt time.Time
+}
+
+// Runtime holds the current settings. Each request reads them once, so that a reload never mixes the settings of two
+// configurations within one request.
+type Runtime struct {
+	settings atomic.Pointer[Settings]
+	limiter  *rateLimiter
+	hours    *hourCache
+
+	// requests counts the requests in flight with each settings, and retired holds the channels to close once the
+	// requests of replaced settings are done.
+	usersMu  sync.Mutex
+	requests map[*Settings]int
+	retired  map[*Settings]chan struct{}
+
+	mu          sync.Mutex
+	lastAttempt time.Time
+	lastError   string
+}
+
+func NewRuntime(settings Settings) *Runtime {
+	rt := &Runtime{
+		limiter:  newRateLimiter(settings.RateLimits),
+		hours:    newHourCache(settings.HourCache),
+		requests: map[*Settings]int{},
+		retired:  map[*Settings]chan struct{}{},
+	}
+	rt.settings.Store(&settings)
+	return rt
+}
+
+func (rt *Runtime) Settings() *Settings {
+	return rt.settings.Load()
+}
+
+// acquire returns the current settings for a request, which must call release once it is done with them.
+func (rt *Runtime) acquire() (*Settings, func()) {
+	rt.usersMu.Lock()
+	defer rt.usersMu.Unlock()
+	settings := rt.settings.Load()
+	rt.requests[settings]++
+	return settings, func() {
+		rt.usersMu.Lock()
+		defer rt.usersMu.Unlock()
+		if rt.requests[settings]--; rt.requests[settings] > 0 {
+			return
+		}
+		delete(rt.requests, settings)
+		if done, ok := rt.retired[settings]; ok {
+			close(done)
+			delete(rt.retired, settings)
+		}
+	}
+}
+
+// Swap replaces the current settings. The rate limits are applied to the existing token buckets and query slots, and
+// the cached hours are kept. The returned channel is closed once no request uses the replaced settings anymore, e.g.
+// to close the stores the new settings no longer use.
+func (rt *Runtime) Swap(settings Settings) <-chan struct{} {
+	rt.limiter.configure(settings.RateLimits)
+	rt.hours.configure(settings.HourCache)
+
+	rt.usersMu.Lock()
+	replaced := rt.settings.Swap(&settings)
+	done := make(chan struct{})
+	if rt.requests[replaced] == 0 {
+		close(done)
+	} else {
+		rt.retired[replaced] = done
+	}
+	rt.usersMu.Unlock()
+
+	rt.recordReload(settings.LoadedAt, nil)
+	return done
+}
+
+// RecordReloadError reports a configuration that was rejected; the current settings stay active.
+func (rt *Runtime) RecordReloadError(at time.Time, err error) {
+	rt.recordReload(at, err)
+}
+
+func (rt *Runtime) recordReload(at time.Time, err error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.lastAttempt = at
+	rt.lastError = ""
+	if err != nil {
+		rt.lastError = err.Error()
+	}
+}
+
+func (rt *Runtime) Status() Status {
+	settings := rt.Settings()
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return Status{
+		ConfigVersion:     settings.Version,
+		LoadedAt:          settings.LoadedAt,
+		Streams:           len(settings.Registry.Streams()),
+		LastReloadAttempt: rt.lastAttempt,
+		LastReloadError:   rt.lastError,
+	}
+}
+
+func StatusHandler(w http.ResponseWriter, rt *Runtime) {
+	writeJSONResponse(w, rt.Status())
+}
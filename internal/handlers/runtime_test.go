@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuntimeSwap(t *testing.T) {
+	store := storage.NewFS(fstest.MapFS{}, "memory")
+	initial, err := NewRegistry(nil, Stream{Name: "audit", Store: store})
+	require.NoError(t, err)
+	reloaded, err := NewRegistry(nil, Stream{Name: "audit", Store: store}, Stream{Name: "billing", Store: store})
+	require.NoError(t, err)
+
+	loadedAt := time.Date(2025, 1, 17, 2, 0, 0, 0, time.UTC)
+	rt := NewRuntime(Settings{Registry: initial, Limits: DefaultLimits(), Version: "v1", LoadedAt: loadedAt})
+	router := NewRuntimeRouter(rt)
+
+	coverageCode := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/streams/billing/coverage?start=1737080400000&end=1737084000000", http.NoBody)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	status := func() Status {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/status", http.NoBody))
+		require.Equal(t, http.StatusOK, rr.Code)
+		var s Status
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &s))
+		return s
+	}
+
+	assert.Equal(t, http.StatusNotFound, coverageCode())
+	assert.Equal(t, Status{ConfigVersion: "v1", LoadedAt: loadedAt, Streams: 1}, status())
+
+	rejectedAt := loadedAt.Add(time.Minute)
+	rt.RecordReloadError(rejectedAt, errors.New("invalid config"))
+	assert.Equal(t, Status{
+		ConfigVersion:     "v1",
+		LoadedAt:          loadedAt,
+		Streams:           1,
+		LastReloadAttempt: rejectedAt,
+		LastReloadError:   "invalid config",
+	}, status())
+
+	swappedAt := rejectedAt.Add(time.Minute)
+	rt.Swap(Settings{Registry: reloaded, Limits: DefaultLimits(), Version: "v2", LoadedAt: swappedAt})
+	assert.Equal(t, http.StatusOK, coverageCode())
+	assert.Equal(t, Status{ConfigVersion: "v2", LoadedAt: swappedAt, Streams: 2, LastReloadAttempt: swappedAt}, status())
+}
+
+func TestRuntimeSwapWaitsForRequests(t *testing.T) {
+	registry, err := NewRegistry(nil, Stream{Name: "audit", Store: storage.NewFS(fstest.MapFS{}, "memory")})
+	require.NoError(t, err)
+	rt := NewRuntime(Settings{Registry: registry, Version: "v1"})
+
+	_, release := rt.acquire()
+	replaced := rt.Swap(Settings{Registry: registry, Version: "v2"})
+	select {
+	case <-replaced:
+		t.Fatal("the replaced settings are still used by a request")
+	default:
+	}
+
+	current, releaseCurrent := rt.acquire()
+	assert.Equal(t, "v2", current.Version)
+	releaseCurrent()
+	release()
+	<-replaced
+
+	select {
+	case <-rt.Swap(Settings{Registry: registry, Version: "v3"}):
+	default:
+		t.Fatal("settings without requests are released at once")
+	}
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/storage"
+)
+
+const prefixDelimiter = storage.Delimiter
+
+func ListStreamsHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, registry *Registry, limits Limits) {
+	withMetadata := r.URL.Query().Get("metadata") == "true"
+
+	extendWriteDeadline(w, limits.StreamsTimeout)
+	timeoutCtx, cancel := context.WithTimeout(ctx, limits.StreamsTimeout)
+	defer cancel()
+
+	streams, err := ListStreams(timeoutCtx, registry, withMetadata)
+	if err != nil {
+		logger(ctx).Error("listing streams", "error", err)
+		http.Error(w, "Unable to list streams", http.StatusBadGateway)
+		return
+	}
+
+	writeJSONResponse(w, streams)
+}
+
+// ListStreams returns the declared streams along with the streams discovered as top-level prefixes of the fallback
+// store. When withMetadata is set, the first and last available hour of every stream are looked up as well, which
+// costs a few partition listings per stream.
+func ListStreams(ctx context.Context, registry *Registry, withMetadata bool) ([]StreamInfo, error) {
+	streams := registry.Streams()
+
+	discovered, err := discoverStreams(ctx, registry)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range discovered {
+		if slices.ContainsFunc(streams, func(s Stream) bool { return s.Name == name }) {
+			continue
+		}
+		if stream, ok := registry.Lookup(name); ok {
+			streams = append(streams, stream)
+		}
+	}
+
+	streams = slices.DeleteFunc(streams, func(s Stream) bool {
+		_, allowed := authorizeStream(ctx, s.Name)
+		return !allowed
+	})
+
+	infos := make([]StreamInfo, 0, len(streams))
+	for _, stream := range streams {
+		if err := ctxCanceled(ctx); err != nil {
+			return nil, err
+		}
+
+		info := StreamInfo{Name: stream.Name}
+		if withMetadata {
+			if err := info.loadMetadata(ctx, stream); err != nil {
+				logger(ctx).Warn("loading stream metadata", "stream", stream.Name, "error", err)
+			}
+		}
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+// discoverStreams lists the stream names found in the fallback store, if the fallback layout allows it.
+func discoverStreams(ctx context.Context, registry *Registry) ([]string, error) {
+	fallback, ok := registry.Fallback()
+	if !ok {
+		return nil, nil
+	}
+	root, ok := fallback.discoveryRoot()
+	if !ok {
+		return nil, nil
+	}
+
+	prefixes, err := fallback.Store.ListPrefixes(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		names = append(names, strings.TrimSuffix(strings.TrimPrefix(prefix, root), prefixDelimiter))
+	}
+	return names, nil
+}
+
+func (s *StreamInfo) loadMetadata(ctx context.Context, stream Stream) error {
+	var err error
+	if s.FirstHour, err = boundaryHour(ctx, stream, slices.Min); err != nil {
+		return err
+	}
+	s.LastHour, err = boundaryHour(ctx, stream, slices.Max)
+	return err
+}
+
+// boundaryHour walks down the partitions of a stream, choosing one partition per level with pick.
+// A zero time is returned when the stream has no partitions matching its prefix template.
+func boundaryHour(ctx context.Context, stream Stream, pick func([]string) string) (time.Time, error) {
+	root := stream.partitionRoot()
+	prefix := root
+	for range stream.partitionDepth() {
+		prefixes, err := stream.Store.ListPrefixes(ctx, prefix)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if len(prefixes) == 0 {
+			return time.Time{}, nil
+		}
+		prefix = pick(prefixes)
+	}
+
+	hour, err := time.Parse(stream.partitionLayout(), strings.TrimPrefix(prefix, root))
+	if err != nil {
+		return time.Time{}, nil //nolint:nilerr // not an hourly partition, so there is no boundary to report
+	}
+	return hour, nil
+}
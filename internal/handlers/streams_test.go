@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/decisiveai/mdai-s3-logs-reader/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newPartitionedS3Client returns a mock that serves delimiter listings and object listings derived from keys.
+func newPartitionedS3Client(t *testing.T, keys map[string]int64) *mockS3Client {
+	t.Helper()
+	lastModified := time.Date(2025, 1, 17, 6, 0, 0, 0, time.UTC)
+	return &mockS3Client{
+		ListObjectsV2Func: func(_ context.Context, params *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+			assert.Equal(t, bucket, aws.ToString(params.Bucket))
+			listPrefix := aws.ToString(params.Prefix)
+			output := &s3.ListObjectsV2Output{}
+			seen := map[string]bool{}
+			for key, size := range keys {
+				rest, found := strings.CutPrefix(key, listPrefix)
+				if !found {
+					continue
+				}
+				if params.Delimiter == nil {
+					output.Contents = append(output.Contents, types.Object{
+						Key:          aws.String(key),
+						LastModified: aws.Time(lastModified),
+						Size:         aws.Int64(size),
+					})
+					continue
+				}
+				dir, _, isDir := strings.Cut(rest, *params.Delimiter)
+				commonPrefix := listPrefix + dir + *params.Delimiter
+				if isDir && !seen[commonPrefix] {
+					seen[commonPrefix] = true
+					output.CommonPrefixes = append(output.CommonPrefixes, types.CommonPrefix{Prefix: aws.String(commonPrefix)})
+				}
+			}
+			return output, nil
+		},
+	}
+}
+
+func TestListStreamsHandler(t *testing.T) {
+	keys := map[string]int64{
+		"hub-monitor-hub-logs/2025/01/17/02/a.json": 100,
+		"hub-monitor-hub-logs/2025/01/17/05/b.json": 200,
+		"hub-monitor-hub-logs/2024/12/31/23/c.json": 50,
+		"mdaihub-sample-hub/2025/02/01/00/d.json":   10,
+		"top-level-object.json":                     1,
+	}
+
+	cases := []struct {
+		name       string
+		requestURL string
+		expect     []StreamInfo
+	}{
+		{
+			name:       "NamesOnly",
+			requestURL: "/streams",
+			expect: []StreamInfo{
+				{Name: "hub-monitor-hub-logs"},
+				{Name: "mdaihub-sample-hub"},
+			},
+		},
+		{
+			name:       "WithMetadata",
+			requestURL: "/streams?metadata=true",
+			expect: []StreamInfo{
+				{
+					Name:      "hub-monitor-hub-logs",
+					FirstHour: time.Date(2024, 12, 31, 23, 0, 0, 0, time.UTC),
+					LastHour:  time.Date(2025, 1, 17, 5, 0, 0, 0, time.UTC),
+				},
+				{
+					Name:      "mdaihub-sample-hub",
+					FirstHour: time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC),
+					LastHour:  time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC),
+				},
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.requestURL, http.NoBody)
+			rr := httptest.NewRecorder()
+			client := newPartitionedS3Client(t, keys)
+			list := client.ListObjectsV2Func
+			client.ListObjectsV2Func = func(ctx context.Context, params *s3.ListObjectsV2Input,
+				optFns ...func(*s3.Options),
+			) (*s3.ListObjectsV2Output, error) {
+				assert.NotNil(t, params.Delimiter, "streams are listed by partition, never object by object")
+				return list(ctx, params, optFns...)
+			}
+			NewRouter(newTestRegistry(t, client), DefaultLimits()).ServeHTTP(rr, req)
+
+			require.Equal(t, http.StatusOK, rr.Code)
+			var streams []StreamInfo
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &streams))
+			assert.ElementsMatch(t, tt.expect, streams)
+		})
+	}
+}
+
+func TestListStreamsDeclared(t *testing.T) {
+	registry, err := NewRegistry(
+		&Stream{Store: storage.NewS3(newPartitionedS3Client(t, map[string]int64{
+			"hub-monitor-hub-logs/2025/01/17/02/a.json": 1,
+		}), bucket), Patterns: []string{"*"}},
+		Stream{
+			Name:           "audit",
+			PrefixTemplate: "exports/audit/{year}-{month}-{day}/{hour}/",
+			Store: storage.NewFS(fstest.MapFS{
+				"exports/audit/2025-01-16/23/a.json": {Data: make([]byte, 5)},
+				"exports/audit/2025-01-17/01/b.json": {Data: make([]byte, 7)},
+			}, "memory"),
+		},
+	)
+	require.NoError(t, err)
+
+	streams, err := ListStreams(t.Context(), registry, true)
+	require.NoError(t, err)
+	assert.Equal(t, []StreamInfo{
+		{
+			Name:      "audit",
+			FirstHour: time.Date(2025, 1, 16, 23, 0, 0, 0, time.UTC),
+			LastHour:  time.Date(2025, 1, 17, 1, 0, 0, 0, time.UTC),
+		},
+		{
+			Name:      "hub-monitor-hub-logs",
+			FirstHour: time.Date(2025, 1, 17, 2, 0, 0, 0, time.UTC),
+			LastHour:  time.Date(2025, 1, 17, 2, 0, 0, 0, time.UTC),
+		},
+	}, streams)
+}
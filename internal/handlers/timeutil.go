@@ -2,11 +2,26 @@ package handlers
 
 import (
 	"errors"
+	"fmt"
 	"strconv"
 	"time"
 )
 
-func processTimeRange(start string, end string) (startTime time.Time, endTime time.Time, err error) { //nolint:nonamedreturns
+func processTimeRange(start string, end string, maxRange time.Duration) (startTime time.Time, endTime time.Time, err error) { //nolint:nonamedreturns
+	startTime, endTime, err = parseTimeRange(start, end, maxRange)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	if endTime.Sub(startTime) < time.Hour {
+		startTime = startTime.Truncate(time.Hour)
+		endTime = startTime.Add(time.Hour - time.Nanosecond)
+	}
+	return startTime, endTime, nil
+}
+
+// parseTimeRange parses a pair of unix millisecond timestamps and checks that they span at most maxRange.
+func parseTimeRange(start string, end string, maxRange time.Duration) (startTime time.Time, endTime time.Time, err error) { //nolint:nonamedreturns
 	if startInt, err := strconv.ParseInt(start, 10, 64); err == nil {
 		startTime = time.UnixMilli(startInt).UTC()
 	}
@@ -18,13 +33,29 @@ func processTimeRange(start string, end string) (startTime time.Time, endTime ti
 	if endTime.Before(startTime) {
 		return time.Time{}, time.Time{}, errors.New("end time must be greater than start time")
 	}
-	if endTime.Sub(startTime) > 4*time.Hour {
-		return time.Time{}, time.Time{}, errors.New("time range must be 4 hours or less")
+	if endTime.Sub(startTime) > maxRange {
+		return time.Time{}, time.Time{}, fmt.Errorf("time range must be %s or less", formatRange(maxRange))
 	}
+	return startTime, endTime, nil
+}
 
-	if endTime.Sub(startTime) < time.Hour {
-		startTime = startTime.Truncate(time.Hour)
-		endTime = startTime.Add(time.Hour - time.Nanosecond)
+// hoursInRange returns the start of every hourly partition touched by [start, end].
+func hoursInRange(start time.Time, end time.Time) []time.Time {
+	var hours []time.Time
+	for t := start.Truncate(time.Hour); !t.After(end); t = t.Add(time.Hour) {
+		hours = append(hours, t)
+	}
+	return hours
+}
+
+func formatRange(d time.Duration) string {
+	hours := int(d / time.Hour)
+	switch {
+	case hours%24 == 0 && hours > 24:
+		return fmt.Sprintf("%d days", hours/24)
+	case hours == 1:
+		return "1 hour"
+	default:
+		return fmt.Sprintf("%d hours", hours)
 	}
-	return startTime, endTime, nil
 }
@@ -54,7 +54,7 @@ func TestProcessTimeRange(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			start, end, err := processTimeRange(tt.startString, tt.endString)
+			start, end, err := processTimeRange(tt.startString, tt.endString, defaultMaxLogsRange)
 			assert.Equal(t, tt.startTime, start)
 			assert.Equal(t, tt.endTime, end)
 			require.Equal(t, err, tt.err)
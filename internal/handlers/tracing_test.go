@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestListLogsHandlerSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	testFile, err := os.ReadFile(logFile1)
+	require.NoError(t, err)
+	mockClient := &mockS3Client{
+		ListObjectsV2Func: func(_ context.Context, _ *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+			return &s3.ListObjectsV2Output{Contents: []types.Object{
+				{Key: aws.String("valid.json"), LastModified: aws.Time(time.Now())},
+				{Key: aws.String("corrupt.json"), LastModified: aws.Time(time.Now())},
+			}}, nil
+		},
+		GetObjectFunc: func(_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+			body := testFile
+			if *params.Key == "corrupt.json" {
+				body = []byte("{not json")
+			}
+			return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(body))}, nil
+		},
+	}
+
+	ctx, server := provider.Tracer("test").Start(t.Context(), "GET")
+	req := httptest.NewRequestWithContext(ctx, http.MethodGet, "/logs/hub-monitor-hub-logs/files?start=1737080400000&end=1737080400000", http.NoBody)
+	NewRouter(newTestRegistry(t, mockClient), DefaultLimits()).ServeHTTP(httptest.NewRecorder(), req)
+	server.End()
+
+	spans := map[string][]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = append(spans[span.Name()], span)
+	}
+	require.Len(t, spans["GET /logs/{auditPath}/{timestamp}"], 1, "the server span is named after the route")
+	require.Len(t, spans["load prefix"], 1)
+	assert.Len(t, spans["list"], 1)
+	assert.Len(t, spans["get"], 2)
+	require.Len(t, spans["parse"], 2)
+
+	load := spans["load prefix"][0]
+	assert.Contains(t, load.Attributes(), attribute.String("prefix", "hub-monitor-hub-logs/2025/01/17/02/"))
+	assert.Equal(t, spans["GET /logs/{auditPath}/{timestamp}"][0].SpanContext().SpanID(), load.Parent().SpanID())
+	for _, parse := range spans["parse"] {
+		assert.Equal(t, load.SpanContext().SpanID(), parse.Parent().SpanID())
+		if slices.Contains(parse.Attributes(), attribute.String("key", "corrupt.json")) {
+			assert.Equal(t, codes.Error, parse.Status().Code)
+		}
+	}
+}
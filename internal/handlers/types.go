@@ -10,9 +10,37 @@ import (
 
 type apiResponse []map[string]string
 
-type ListedObject struct {
-	Key          string    `json:"key"`
-	LastModified time.Time `json:"last_modified"` //nolint:tagliatelle
+type StreamInfo struct {
+	Name      string    `json:"name"`
+	FirstHour time.Time `json:"firstHour,omitzero"`
+	LastHour  time.Time `json:"lastHour,omitzero"`
+}
+
+type StreamCoverage struct {
+	Stream       string         `json:"stream"`
+	Start        time.Time      `json:"start"`
+	End          time.Time      `json:"end"`
+	CoveredHours int            `json:"coveredHours"`
+	MissingHours int            `json:"missingHours"`
+	TotalObjects int            `json:"totalObjects"`
+	TotalBytes   int64          `json:"totalBytes"`
+	Hours        []HourCoverage `json:"hours"`
+	Gaps         []CoverageGap  `json:"gaps"`
+}
+
+type HourCoverage struct {
+	Hour    time.Time `json:"hour"`
+	Prefix  string    `json:"prefix"`
+	Objects int       `json:"objects"`
+	Bytes   int64     `json:"bytes"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// CoverageGap is a run of consecutive hours without any objects; End is exclusive.
+type CoverageGap struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Hours int       `json:"hours"`
 }
 
 type LogRecord struct {
@@ -39,6 +67,55 @@ type LogRecord struct {
 	MetricName          string `json:"metricName,omitempty"`
 	Value               string `json:"value,omitempty"`
 	RelevantLabelValues string `json:"relevantLabelValues,omitempty"`
+
+	// attrs holds the plain values of the attributes policies constrain, which the fields above hold in their
+	// protobuf text form.
+	attrs recordAttrs
+}
+
+type recordAttrs struct {
+	hubName, mdaiHub, namespace, serviceName, pod, controller, controllerKind, name string
+}
+
+type LogsEnvelope struct {
+	Stream       string       `json:"stream"`
+	Logs         []LogRecord  `json:"logs"`
+	IngestionLag IngestionLag `json:"ingestionLag"`
+}
+
+// QueryTimeout answers a logs query that exceeded limits.queryTimeout, with 504. It lists the hours that were read and
+// those left, which can be queried again, e.g. with a narrower range.
+type QueryTimeout struct {
+	Error          string      `json:"error"`
+	Stream         string      `json:"stream"`
+	CompletedHours []time.Time `json:"completedHours"`
+	MissingHours   []time.Time `json:"missingHours"`
+	// Records is the number of records read from the completed hours.
+	Records int `json:"records"`
+}
+
+type IngestionLag struct {
+	Objects      int       `json:"objects"`
+	MinSeconds   float64   `json:"minSeconds"`
+	MaxSeconds   float64   `json:"maxSeconds"`
+	AvgSeconds   float64   `json:"avgSeconds"`
+	NewestRecord time.Time `json:"newestRecord,omitzero"`
+	NewestObject time.Time `json:"newestObject,omitzero"`
+}
+
+type ObjectLag struct {
+	Key          string    `json:"key"`
+	LastModified time.Time `json:"lastModified"`
+	NewestRecord time.Time `json:"newestRecord"`
+	LagSeconds   float64   `json:"lagSeconds"`
+}
+
+type StreamLag struct {
+	Stream                 string       `json:"stream"`
+	Hour                   time.Time    `json:"hour"`
+	IngestionLag           IngestionLag `json:"ingestionLag"`
+	NewestRecordAgeSeconds float64      `json:"newestRecordAgeSeconds"`
+	Objects                []ObjectLag  `json:"objects"`
 }
 
 func newLogRecord(logRecord *logspb.LogRecord, resourceLog *logspb.ResourceLogs) LogRecord {
@@ -76,6 +153,16 @@ func newLogRecord(logRecord *logspb.LogRecord, resourceLog *logspb.ResourceLogs)
 		Value:               get("value"),
 		RelevantLabelValues: get("relevantLabelValues"),
 		Count:               1,
+		attrs: recordAttrs{
+			hubName:        getAttribute(logRecordAttrs, "hub_name").GetStringValue(),
+			mdaiHub:        getAttribute(logRecordAttrs, "MdaiHub").GetStringValue(),
+			namespace:      getAttribute(logRecordAttrs, "namespace").GetStringValue(),
+			serviceName:    getAttribute(resourceAttrs, "service.name").GetStringValue(),
+			pod:            getAttribute(resourceAttrs, "k8s.object.name").GetStringValue(),
+			controller:     getAttribute(logRecordAttrs, "controller").GetStringValue(),
+			controllerKind: getAttribute(logRecordAttrs, "controllerKind").GetStringValue(),
+			name:           getAttribute(logRecordAttrs, "name").GetStringValue(),
+		},
 	}
 }
 
@@ -90,3 +177,26 @@ func (lr LogRecord) key() string {
 		lr.Body,
 	}, "|")
 }
+
+// Status describes the configuration the server is running with.
+type Status struct {
+	ConfigVersion     string    `json:"configVersion"`
+	LoadedAt          time.Time `json:"loadedAt,omitzero"`
+	Streams           int       `json:"streams"`
+	LastReloadAttempt time.Time `json:"lastReloadAttempt,omitzero"`
+	LastReloadError   string    `json:"lastReloadError,omitempty"`
+}
+
+type Readiness struct {
+	Status        string       `json:"status"`
+	ConfigVersion string       `json:"configVersion,omitempty"`
+	CheckedAt     time.Time    `json:"checkedAt"`
+	Stores        []StoreCheck `json:"stores"`
+}
+
+type StoreCheck struct {
+	Location   string `json:"location"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+)
+
+// AzureBlob reads the blobs of an Azure Blob Storage container, whose names follow the same layout as S3 keys.
+type AzureBlob struct {
+	client *container.Client
+}
+
+var _ Store = (*AzureBlob)(nil)
+
+func NewAzureBlob(client *container.Client) *AzureBlob {
+	return &AzureBlob{client: client}
+}
+
+// Location is azblob://<host>/<container> for the host and path of the container URL, without its query string: the
+// URL of a client made from a SAS connection string carries the token, while locations are logged and served.
+func (a *AzureBlob) Location() string {
+	u, err := url.Parse(a.client.URL())
+	if err != nil {
+		return "azblob://"
+	}
+	return "azblob://" + u.Host + strings.TrimSuffix(u.Path, "/")
+}
+
+func (a *AzureBlob) List(ctx context.Context, prefix string) ([]Object, error) {
+	var listed []Object
+	pager := a.client.NewListBlobsFlatPager(&container.ListBlobsFlatOptions{Prefix: &prefix})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return listed, err
+		}
+		for _, item := range page.Segment.BlobItems {
+			if item.Name == nil || item.Properties == nil || item.Properties.LastModified == nil {
+				continue
+			}
+			obj := Object{
+				Key:          *item.Name,
+				LastModified: item.Properties.LastModified.UTC(),
+			}
+			if item.Properties.ContentLength != nil {
+				obj.Size = *item.Properties.ContentLength
+			}
+			if item.Properties.ETag != nil {
+				obj.ETag = string(*item.Properties.ETag)
+			}
+			listed = append(listed, obj)
+		}
+	}
+	return listed, nil
+}
+
+func (a *AzureBlob) ListPrefixes(ctx context.Context, prefix string) ([]string, error) {
+	var prefixes []string
+	pager := a.client.NewListBlobsHierarchyPager(Delimiter, &container.ListBlobsHierarchyOptions{Prefix: &prefix})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, blobPrefix := range page.Segment.BlobPrefixes {
+			if blobPrefix.Name != nil {
+				prefixes = append(prefixes, *blobPrefix.Name)
+			}
+		}
+	}
+	return prefixes, nil
+}
+
+func (a *AzureBlob) Get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := a.client.NewBlobClient(key).DownloadStream(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			slog.Warn("closing response body", "error", err)
+		}
+	}()
+	return io.ReadAll(resp.Body)
+}
+
+// Check verifies that the container exists and is accessible with the client's credentials.
+func (a *AzureBlob) Check(ctx context.Context) error {
+	_, err := a.client.GetProperties(ctx, nil)
+	return err
+}
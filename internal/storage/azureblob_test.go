@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const azureContainerPath = "/devstoreaccount1/logs"
+
+type azureEnumerationResults struct {
+	XMLName    xml.Name `xml:"EnumerationResults"`
+	Prefix     string   `xml:"Prefix"`
+	Blobs      azureBlobs
+	NextMarker string `xml:"NextMarker"`
+}
+
+type azureBlobs struct {
+	XMLName    xml.Name          `xml:"Blobs"`
+	Blob       []azureBlob       `xml:"Blob"`
+	BlobPrefix []azureBlobPrefix `xml:"BlobPrefix"`
+}
+
+type azureBlob struct {
+	Name          string `xml:"Name"`
+	LastModified  string `xml:"Properties>Last-Modified"`
+	ContentLength int    `xml:"Properties>Content-Length"`
+}
+
+type azureBlobPrefix struct {
+	Name string `xml:"Name"`
+}
+
+// newAzuriteServer emulates the subset of the Blob service REST API used by AzureBlob, addressed like Azurite.
+func newAzuriteServer(t *testing.T, objects map[string]fakeObject) *container.Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		switch {
+		case r.URL.Path == azureContainerPath && query.Get("comp") == "list":
+			keys, prefixes := fakeListing(objects, query.Get("prefix"), query.Get("delimiter"))
+			results := azureEnumerationResults{Prefix: query.Get("prefix")}
+			for _, key := range keys {
+				results.Blobs.Blob = append(results.Blobs.Blob, azureBlob{
+					Name:          key,
+					LastModified:  objects[key].lastModified.Format(http.TimeFormat),
+					ContentLength: len(objects[key].data),
+				})
+			}
+			for _, prefix := range prefixes {
+				results.Blobs.BlobPrefix = append(results.Blobs.BlobPrefix, azureBlobPrefix{Name: prefix})
+			}
+			w.Header().Set("Content-Type", "application/xml")
+			assert.NoError(t, xml.NewEncoder(w).Encode(results))
+		case r.URL.Path == azureContainerPath && query.Get("restype") == "container":
+			w.WriteHeader(http.StatusOK)
+		case strings.HasPrefix(r.URL.Path, azureContainerPath+"/"):
+			obj, found := objects[strings.TrimPrefix(r.URL.Path, azureContainerPath+"/")]
+			if !found {
+				w.Header().Set("x-ms-error-code", "BlobNotFound")
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Length", strconv.Itoa(len(obj.data)))
+			w.Header().Set("Last-Modified", obj.lastModified.Format(http.TimeFormat))
+			_, _ = w.Write(obj.data)
+		default:
+			w.Header().Set("x-ms-error-code", "ContainerNotFound")
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := container.NewClientWithNoCredential(server.URL+azureContainerPath, nil)
+	require.NoError(t, err)
+	return client
+}
+
+func TestAzureBlob(t *testing.T) {
+	store := NewAzureBlob(newAzuriteServer(t, fakeObjects()))
+	ctx := t.Context()
+
+	require.NoError(t, store.Check(ctx))
+
+	objects, err := store.List(ctx, "hub-monitor-hub-logs/")
+	require.NoError(t, err)
+	assert.Equal(t, []Object{
+		{Key: "hub-monitor-hub-logs/2025/01/17/02/a.json", LastModified: fakeLastModified, Size: 1},
+		{Key: "hub-monitor-hub-logs/2025/01/17/03/b.json", LastModified: fakeLastModified, Size: 2},
+	}, objects)
+
+	prefixes, err := store.ListPrefixes(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"hub-monitor-hub-logs/", "other-stream/"}, prefixes)
+
+	prefixes, err = store.ListPrefixes(ctx, "hub-monitor-hub-logs/2025/01/17/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"hub-monitor-hub-logs/2025/01/17/02/", "hub-monitor-hub-logs/2025/01/17/03/"}, prefixes)
+
+	data, err := store.Get(ctx, "other-stream/2025/01/17/03/c.json")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("ccc"), data)
+
+	_, err = store.Get(ctx, "missing.json")
+	require.Error(t, err)
+}
+
+func TestAzureBlobLocation(t *testing.T) {
+	client, err := container.NewClientFromConnectionString(
+		"BlobEndpoint=https://account.blob.core.windows.net/;SharedAccessSignature=sv=2022-11-02&sig=secret", "logs", nil)
+	require.NoError(t, err)
+	require.Contains(t, client.URL(), "sig=secret")
+
+	assert.Equal(t, "azblob://account.blob.core.windows.net/logs", NewAzureBlob(client).Location())
+}
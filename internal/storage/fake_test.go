@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// fakeObject is an object served by the in-process emulators of the Azure and GCS tests.
+type fakeObject struct {
+	data         []byte
+	lastModified time.Time
+}
+
+var fakeLastModified = time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func fakeObjects() map[string]fakeObject {
+	return map[string]fakeObject{
+		"hub-monitor-hub-logs/2025/01/17/02/a.json": {data: []byte("a"), lastModified: fakeLastModified},
+		"hub-monitor-hub-logs/2025/01/17/03/b.json": {data: []byte("bb"), lastModified: fakeLastModified},
+		"other-stream/2025/01/17/03/c.json":         {data: []byte("ccc"), lastModified: fakeLastModified},
+	}
+}
+
+// fakeListing splits the objects below prefix into keys and, when a delimiter is given, common prefixes.
+func fakeListing(objects map[string]fakeObject, prefix, delimiter string) (keys []string, prefixes []string) { //nolint:nonamedreturns
+	for key := range objects {
+		rest, found := strings.CutPrefix(key, prefix)
+		if !found {
+			continue
+		}
+		if delimiter != "" {
+			if dir, _, isDir := strings.Cut(rest, delimiter); isDir {
+				if commonPrefix := prefix + dir + delimiter; !slices.Contains(prefixes, commonPrefix) {
+					prefixes = append(prefixes, commonPrefix)
+				}
+				continue
+			}
+		}
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	slices.Sort(prefixes)
+	return keys, prefixes
+}
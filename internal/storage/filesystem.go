@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Filesystem serves a local copy of a bucket, where every key is a "/" separated path relative to the root.
+type Filesystem struct {
+	fsys     fs.FS
+	location string
+	// root is the directory opened by NewFilesystem, if any.
+	root *os.Root
+}
+
+var _ Store = (*Filesystem)(nil)
+
+// NewFilesystem opens dir as a store. Keys cannot escape dir, neither with ".." nor through symlinks.
+func NewFilesystem(dir string) (*Filesystem, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	// The root stays open until Close.
+	root, err := os.OpenRoot(abs)
+	if err != nil {
+		return nil, fmt.Errorf("opening storage directory: %w", err)
+	}
+	store := NewFS(root.FS(), "file://"+filepath.ToSlash(abs))
+	store.root = root
+	return store, nil
+}
+
+// Close releases the directory opened by NewFilesystem.
+func (f *Filesystem) Close() error {
+	if f.root == nil {
+		return nil
+	}
+	return f.root.Close()
+}
+
+func NewFS(fsys fs.FS, location string) *Filesystem {
+	return &Filesystem{fsys: fsys, location: location}
+}
+
+func (f *Filesystem) Location() string {
+	return f.location
+}
+
+func (f *Filesystem) List(ctx context.Context, prefix string) ([]Object, error) {
+	var objects []Object
+	err := fs.WalkDir(f.fsys, dirOf(prefix), func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			dir := strings.TrimPrefix(name+Delimiter, "."+Delimiter)
+			if !strings.HasPrefix(dir, prefix) && !strings.HasPrefix(prefix, dir) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, Object{
+			Key:          name,
+			LastModified: info.ModTime().UTC(),
+			Size:         info.Size(),
+		})
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	// Directory order differs from S3's byte order when names share a prefix, e.g. "logs/" and "logs-old/".
+	slices.SortFunc(objects, func(a, b Object) int { return strings.Compare(a.Key, b.Key) })
+	return objects, err
+}
+
+func (f *Filesystem) ListPrefixes(ctx context.Context, prefix string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	dir := dirOf(prefix)
+	entries, err := fs.ReadDir(f.fsys, dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var prefixes []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		candidate := strings.TrimPrefix(path.Join(dir, entry.Name())+Delimiter, "."+Delimiter)
+		if strings.HasPrefix(candidate, prefix) {
+			prefixes = append(prefixes, candidate)
+		}
+	}
+	slices.Sort(prefixes)
+	return prefixes, nil
+}
+
+func (f *Filesystem) Get(ctx context.Context, key string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return fs.ReadFile(f.fsys, key)
+}
+
+func (f *Filesystem) Check(_ context.Context) error {
+	info, err := fs.Stat(f.fsys, ".")
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", f.location)
+	}
+	return nil
+}
+
+// dirOf returns the directory that holds every key starting with prefix, as an fs.FS path.
+func dirOf(prefix string) string {
+	i := strings.LastIndex(prefix, Delimiter)
+	if i <= 0 {
+		return "."
+	}
+	return prefix[:i]
+}
@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestFS() *Filesystem {
+	modTime := time.Date(2025, 1, 17, 3, 0, 0, 0, time.UTC)
+	return NewFS(fstest.MapFS{
+		"hub-monitor-hub-logs/2025/01/17/02/a.json":     {Data: []byte("a"), ModTime: modTime},
+		"hub-monitor-hub-logs/2025/01/17/02/b.json":     {Data: []byte("bb"), ModTime: modTime},
+		"hub-monitor-hub-logs/2025/01/17/03/c.json":     {Data: []byte("ccc"), ModTime: modTime},
+		"hub-monitor-hub-logs-old/2024/01/01/00/d.json": {Data: []byte("d"), ModTime: modTime},
+		"top-level.json": {Data: []byte("t"), ModTime: modTime},
+	}, "memory")
+}
+
+func TestFilesystemList(t *testing.T) {
+	store := newTestFS()
+	tests := []struct {
+		name   string
+		prefix string
+		keys   []string
+	}{
+		{
+			name:   "HourPartition",
+			prefix: "hub-monitor-hub-logs/2025/01/17/02/",
+			keys:   []string{"hub-monitor-hub-logs/2025/01/17/02/a.json", "hub-monitor-hub-logs/2025/01/17/02/b.json"},
+		},
+		{
+			name:   "Stream",
+			prefix: "hub-monitor-hub-logs/",
+			keys: []string{
+				"hub-monitor-hub-logs/2025/01/17/02/a.json",
+				"hub-monitor-hub-logs/2025/01/17/02/b.json",
+				"hub-monitor-hub-logs/2025/01/17/03/c.json",
+			},
+		},
+		{
+			name:   "PartialName",
+			prefix: "hub-monitor-hub-logs-",
+			keys:   []string{"hub-monitor-hub-logs-old/2024/01/01/00/d.json"},
+		},
+		{
+			name:   "Missing",
+			prefix: "hub-monitor-hub-logs/2025/01/18/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects, err := store.List(t.Context(), tt.prefix)
+			require.NoError(t, err)
+			keys := make([]string, 0, len(objects))
+			for _, obj := range objects {
+				keys = append(keys, obj.Key)
+			}
+			assert.ElementsMatch(t, tt.keys, keys)
+		})
+	}
+}
+
+func TestFilesystemListPrefixes(t *testing.T) {
+	store := newTestFS()
+
+	prefixes, err := store.ListPrefixes(t.Context(), "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"hub-monitor-hub-logs-old/", "hub-monitor-hub-logs/"}, prefixes)
+
+	prefixes, err = store.ListPrefixes(t.Context(), "hub-monitor-hub-logs/2025/01/17/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"hub-monitor-hub-logs/2025/01/17/02/", "hub-monitor-hub-logs/2025/01/17/03/"}, prefixes)
+
+	prefixes, err = store.ListPrefixes(t.Context(), "missing/")
+	require.NoError(t, err)
+	assert.Empty(t, prefixes)
+}
+
+func TestFilesystemGet(t *testing.T) {
+	store := newTestFS()
+
+	data, err := store.Get(t.Context(), "hub-monitor-hub-logs/2025/01/17/03/c.json")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("ccc"), data)
+
+	_, err = store.Get(t.Context(), "hub-monitor-hub-logs/../top-level.json")
+	require.Error(t, err)
+}
+
+func TestNewFilesystem(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "bucket")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "stream", "2025", "01", "17", "02"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "stream", "2025", "01", "17", "02", "a.json"), []byte("{}"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(parent, "secret.json"), []byte("{}"), 0o600))
+
+	store, err := NewFilesystem(dir)
+	require.NoError(t, err)
+	require.NoError(t, store.Check(t.Context()))
+
+	objects, err := store.List(t.Context(), "stream/2025/01/17/02/")
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+	assert.Equal(t, int64(2), objects[0].Size)
+
+	_, err = store.Get(t.Context(), "../secret.json")
+	require.Error(t, err)
+
+	_, err = NewFilesystem(filepath.Join(parent, "missing"))
+	require.Error(t, err)
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+
+	gcs "cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// GCS reads the objects of a Google Cloud Storage bucket, whose names follow the same layout as S3 keys.
+type GCS struct {
+	bucket *gcs.BucketHandle
+	name   string
+}
+
+var _ Store = (*GCS)(nil)
+
+func NewGCS(client *gcs.Client, bucket string) *GCS {
+	return &GCS{bucket: client.Bucket(bucket), name: bucket}
+}
+
+func (g *GCS) Location() string {
+	return "gs://" + g.name
+}
+
+func (g *GCS) List(ctx context.Context, prefix string) ([]Object, error) {
+	query := &gcs.Query{Prefix: prefix}
+	if err := query.SetAttrSelection([]string{"Name", "Updated", "Size", "Etag"}); err != nil {
+		return nil, err
+	}
+
+	var listed []Object
+	it := g.bucket.Objects(ctx, query)
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			return listed, nil
+		}
+		if err != nil {
+			return listed, err
+		}
+		listed = append(listed, Object{
+			Key:          attrs.Name,
+			LastModified: attrs.Updated.UTC(),
+			Size:         attrs.Size,
+			ETag:         attrs.Etag,
+		})
+	}
+}
+
+func (g *GCS) ListPrefixes(ctx context.Context, prefix string) ([]string, error) {
+	query := &gcs.Query{Prefix: prefix, Delimiter: Delimiter}
+	if err := query.SetAttrSelection([]string{"Name"}); err != nil {
+		return nil, err
+	}
+
+	var prefixes []string
+	it := g.bucket.Objects(ctx, query)
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			return prefixes, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		// With a delimiter, "directories" are returned as entries that only carry a prefix.
+		if attrs.Prefix != "" {
+			prefixes = append(prefixes, attrs.Prefix)
+		}
+	}
+}
+
+func (g *GCS) Get(ctx context.Context, key string) ([]byte, error) {
+	reader, err := g.bucket.Object(key).NewReader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := reader.Close(); err != nil {
+			slog.Warn("closing object reader", "error", err)
+		}
+	}()
+	return io.ReadAll(reader)
+}
+
+// Check verifies that the bucket exists and can be listed with the client's credentials.
+func (g *GCS) Check(ctx context.Context) error {
+	it := g.bucket.Objects(ctx, &gcs.Query{})
+	it.PageInfo().MaxSize = 1
+	_, err := it.Next()
+	if errors.Is(err, iterator.Done) {
+		return nil
+	}
+	return err
+}
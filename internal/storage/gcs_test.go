@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	gcs "cloud.google.com/go/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+)
+
+const gcsBucket = "mdai-collector-logs"
+
+type gcsObject struct {
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	Bucket  string `json:"bucket"`
+	Size    string `json:"size"`
+	Updated string `json:"updated"`
+	Etag    string `json:"etag,omitempty"`
+}
+
+type gcsObjects struct {
+	Kind     string      `json:"kind"`
+	Items    []gcsObject `json:"items"`
+	Prefixes []string    `json:"prefixes"`
+}
+
+// newFakeGCSServer emulates the subset of the JSON and XML APIs used by GCS, like fake-gcs-server does.
+func newFakeGCSServer(t *testing.T, objects map[string]fakeObject) *gcs.Client {
+	t.Helper()
+	listPath := "/storage/v1/b/" + gcsBucket + "/o"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == listPath:
+			query := r.URL.Query()
+			keys, prefixes := fakeListing(objects, query.Get("prefix"), query.Get("delimiter"))
+			response := gcsObjects{Kind: "storage#objects", Prefixes: prefixes}
+			for _, key := range keys {
+				item := gcsObject{
+					Kind:    "storage#object",
+					Name:    key,
+					Bucket:  gcsBucket,
+					Size:    strconv.Itoa(len(objects[key].data)),
+					Updated: objects[key].lastModified.Format(time.RFC3339),
+				}
+				// Like GCS, only return the ETag when the selected fields include it.
+				if fields := query.Get("fields"); fields == "" || strings.Contains(fields, "etag") {
+					item.Etag = "etag-" + key
+				}
+				response.Items = append(response.Items, item)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			assert.NoError(t, json.NewEncoder(w).Encode(response))
+		case strings.HasPrefix(r.URL.Path, "/"+gcsBucket+"/"):
+			obj, found := objects[strings.TrimPrefix(r.URL.Path, "/"+gcsBucket+"/")]
+			if !found {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Length", strconv.Itoa(len(obj.data)))
+			_, _ = w.Write(obj.data)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := gcs.NewClient(t.Context(), option.WithEndpoint(server.URL+"/storage/v1/"), option.WithoutAuthentication())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func TestGCS(t *testing.T) {
+	store := NewGCS(newFakeGCSServer(t, fakeObjects()), gcsBucket)
+	ctx := t.Context()
+
+	assert.Equal(t, "gs://"+gcsBucket, store.Location())
+	require.NoError(t, store.Check(ctx))
+
+	objects, err := store.List(ctx, "hub-monitor-hub-logs/")
+	require.NoError(t, err)
+	assert.Equal(t, []Object{
+		{
+			Key:          "hub-monitor-hub-logs/2025/01/17/02/a.json",
+			LastModified: fakeLastModified,
+			Size:         1,
+			ETag:         "etag-hub-monitor-hub-logs/2025/01/17/02/a.json",
+		},
+		{
+			Key:          "hub-monitor-hub-logs/2025/01/17/03/b.json",
+			LastModified: fakeLastModified,
+			Size:         2,
+			ETag:         "etag-hub-monitor-hub-logs/2025/01/17/03/b.json",
+		},
+	}, objects, "ETags are listed, so that rewritten objects change the hour cache fingerprint")
+
+	prefixes, err := store.ListPrefixes(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"hub-monitor-hub-logs/", "other-stream/"}, prefixes)
+
+	data, err := store.Get(ctx, "other-stream/2025/01/17/03/c.json")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("ccc"), data)
+
+	_, err = store.Get(ctx, "missing.json")
+	require.ErrorIs(t, err, gcs.ErrObjectNotExist)
+}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// https://docs.aws.amazon.com/sdk-for-go/v2/developer-guide/sdk-utilities-s3.html
+
+type S3API interface {
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+type S3 struct {
+	client S3API
+	bucket string
+}
+
+var _ Store = (*S3)(nil)
+
+func NewS3(client S3API, bucket string) *S3 {
+	return &S3{client: client, bucket: bucket}
+}
+
+func (s *S3) Location() string {
+	return "s3://" + s.bucket
+}
+
+func (s *S3) List(ctx context.Context, prefix string) ([]Object, error) {
+	var err error
+	var output *s3.ListObjectsV2Output
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	}
+	var objects []types.Object
+	objectPaginator := s3.NewListObjectsV2Paginator(s.client, input)
+	for objectPaginator.HasMorePages() {
+		output, err = objectPaginator.NextPage(ctx)
+		if err != nil {
+			var noBucket *types.NoSuchBucket
+			if errors.As(err, &noBucket) {
+				slog.Error("bucket does not exist", "bucket", s.bucket)
+				err = noBucket
+			}
+			break
+		}
+		objects = append(objects, output.Contents...)
+	}
+
+	var listed []Object
+	for _, obj := range objects {
+		if obj.Key != nil && obj.LastModified != nil {
+			listed = append(listed, Object{
+				Key:          *obj.Key,
+				LastModified: *obj.LastModified,
+				Size:         aws.ToInt64(obj.Size),
+				ETag:         aws.ToString(obj.ETag),
+			})
+		}
+	}
+
+	return listed, err
+}
+
+func (s *S3) ListPrefixes(ctx context.Context, prefix string) ([]string, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket:    aws.String(s.bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String(Delimiter),
+	}
+
+	var prefixes []string
+	paginator := s3.NewListObjectsV2Paginator(s.client, input)
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			var noBucket *types.NoSuchBucket
+			if errors.As(err, &noBucket) {
+				slog.Error("bucket does not exist", "bucket", s.bucket)
+			}
+			return nil, err
+		}
+		for _, commonPrefix := range output.CommonPrefixes {
+			if commonPrefix.Prefix != nil {
+				prefixes = append(prefixes, *commonPrefix.Prefix)
+			}
+		}
+	}
+
+	return prefixes, nil
+}
+
+func (s *S3) Get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			slog.Warn("closing response body", "error", err)
+		}
+	}()
+	return io.ReadAll(resp.Body)
+}
+
+// Check verifies that the bucket exists and can be listed with the client's credentials.
+func (s *S3) Check(ctx context.Context) error {
+	_, err := s.client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket:  aws.String(s.bucket),
+		MaxKeys: aws.Int32(1),
+	})
+	return err
+}
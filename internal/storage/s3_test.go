@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// https://docs.aws.amazon.com/sdk-for-go/v2/developer-guide/unit-testing.html
+
+const (
+	bucket   = "mdai-collector-logs"
+	prefix   = "/hub-monitor-hub-logs/2025/01/17/02/"
+	key      = "some-logfile.json"
+	logFile1 = "../../sample-data/hub-logs-sample.json"
+	logFile2 = "../../sample-data/collector-logs-sample.json"
+)
+
+type mockS3Client struct {
+	GetObjectFunc     func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	ListObjectsV2Func func(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+}
+
+func (m *mockS3Client) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return m.GetObjectFunc(ctx, params, optFns...)
+}
+
+func (m *mockS3Client) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	return m.ListObjectsV2Func(ctx, params, optFns...)
+}
+
+func TestGetObjectFromS3(t *testing.T) {
+	testFile1, err := os.ReadFile(logFile1)
+	require.NoError(t, err)
+	cases := []struct {
+		name     string
+		bucket   string
+		key      string
+		prefix   string
+		testFile []byte
+	}{
+		{"case1", bucket, key, prefix, testFile1},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := &mockS3Client{
+				GetObjectFunc: func(_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+					t.Helper()
+					if params.Bucket == nil {
+						t.Fatal("expect bucket to not be nil")
+					}
+					if e, a := bucket, *params.Bucket; e != a {
+						t.Errorf("expect %v, got %v", e, a)
+					}
+					if params.Key == nil {
+						t.Fatal("expect key to not be nil")
+					}
+					if e, a := key, *params.Key; e != a {
+						t.Errorf("expect %v, got %v", e, a)
+					}
+					return &s3.GetObjectOutput{
+						Body: io.NopCloser(bytes.NewReader(testFile1)),
+					}, nil
+				},
+			}
+			ctx := t.Context()
+			_, err := NewS3(mockClient, tt.bucket).Get(ctx, tt.key)
+			require.NoError(t, err)
+			t.Logf("Success! Test %s", tt.name)
+		})
+	}
+}
+
+func TestListObjectsFromS3(t *testing.T) {
+	expectTime := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name   string
+		bucket string
+		prefix string
+	}{
+		{"case1", bucket, prefix},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := &mockS3Client{
+				ListObjectsV2Func: func(_ context.Context, params *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+					require.NotNil(t, params.Bucket, "expect bucket to be set")
+					assert.Equal(t, bucket, *params.Bucket)
+					assert.Equal(t, prefix, *params.Prefix)
+					return &s3.ListObjectsV2Output{
+						Contents: []types.Object{
+							{
+								Key:          aws.String(logFile1),
+								LastModified: aws.Time(expectTime),
+							},
+							{
+								Key:          aws.String(logFile2),
+								LastModified: aws.Time(expectTime),
+							},
+						},
+						Prefix: aws.String(prefix),
+					}, nil
+				},
+			}
+			ctx := t.Context()
+			content, err := NewS3(mockClient, tt.bucket).List(ctx, tt.prefix)
+			require.NoError(t, err, "Expected no error from List")
+			t.Logf("Success! Test %s output: %+v", tt.name, content)
+		})
+	}
+}
+
+func TestListPrefixesFromS3(t *testing.T) {
+	mockClient := &mockS3Client{
+		ListObjectsV2Func: func(_ context.Context, params *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+			assert.Equal(t, bucket, aws.ToString(params.Bucket))
+			assert.Equal(t, "hub-monitor-hub-logs/2025/01/", aws.ToString(params.Prefix))
+			assert.Equal(t, Delimiter, aws.ToString(params.Delimiter))
+			return &s3.ListObjectsV2Output{
+				CommonPrefixes: []types.CommonPrefix{
+					{Prefix: aws.String("hub-monitor-hub-logs/2025/01/17/")},
+					{Prefix: aws.String("hub-monitor-hub-logs/2025/01/18/")},
+				},
+			}, nil
+		},
+	}
+
+	prefixes, err := NewS3(mockClient, bucket).ListPrefixes(t.Context(), "hub-monitor-hub-logs/2025/01/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"hub-monitor-hub-logs/2025/01/17/",
+		"hub-monitor-hub-logs/2025/01/18/",
+	}, prefixes)
+}
+
+func TestCheckS3(t *testing.T) {
+	mockClient := &mockS3Client{
+		ListObjectsV2Func: func(_ context.Context, params *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+			assert.Equal(t, int32(1), aws.ToInt32(params.MaxKeys))
+			if aws.ToString(params.Bucket) != bucket {
+				return nil, &types.NoSuchBucket{}
+			}
+			return &s3.ListObjectsV2Output{}, nil
+		},
+	}
+
+	require.NoError(t, NewS3(mockClient, bucket).Check(t.Context()))
+	require.ErrorAs(t, NewS3(mockClient, "missing").Check(t.Context()), new(*types.NoSuchBucket))
+}
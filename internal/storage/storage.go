@@ -0,0 +1,29 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+const Delimiter = "/"
+
+type Object struct {
+	Key          string    `json:"key"`
+	LastModified time.Time `json:"last_modified"` //nolint:tagliatelle
+	Size         int64     `json:"size"`
+	// ETag identifies the content of the object, when the backend provides one.
+	ETag string `json:"etag,omitempty"`
+}
+
+// Store reads objects laid out with "/" separated keys, as exported to an S3 bucket.
+type Store interface {
+	// List returns every object whose key starts with prefix.
+	List(ctx context.Context, prefix string) ([]Object, error)
+	// ListPrefixes returns the "directories" directly below prefix, each ending with the delimiter.
+	ListPrefixes(ctx context.Context, prefix string) ([]string, error)
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Check verifies that the store is reachable and readable.
+	Check(ctx context.Context) error
+	// Location describes where the objects live, e.g. s3://bucket, for logs and error messages.
+	Location() string
+}